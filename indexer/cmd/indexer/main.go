@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"os"
 	"sync"
 
 	"github.com/mateuszdyminski/auto/indexer/pkg/config"
@@ -17,6 +20,12 @@ var debug bool
 
 func init() {
 	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  run        index flight crashes from NATS (default)\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  regeocode  geocode again indexed crashes without coordinates\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  reindex    move crashes into new versioned index and swap the alias\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
 		flag.PrintDefaults()
 	}
 
@@ -43,6 +52,25 @@ func main() {
 	}
 
 	ctx := signals.SetupSignalContext()
+
+	switch flag.Arg(0) {
+	case "", "run":
+		run(ctx, cfg, idx)
+	case "regeocode":
+		if err := idx.Regeocode(ctx); err != nil {
+			log.Fatal().Msgf("can't re-geocode flights. err: %s", err)
+		}
+	case "reindex":
+		if err := idx.Reindex(ctx); err != nil {
+			log.Fatal().Msgf("can't reindex flights. err: %s", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, cfg *config.Config, idx *indexer.Indexer) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
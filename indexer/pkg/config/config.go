@@ -10,21 +10,45 @@ import (
 // Config holds configuration of feeder.
 type Config struct {
 	// NATS config
-	NATSAddress string
-	Topic       string
-	OutTopic    string
-	QueueGroup  string
+	NATSAddress     string
+	Topic           string
+	OutTopic        string
+	DeadLetterTopic string
+	QueueGroup      string
 
 	// Elastisearch config
-	Elastics []string
-	BulkSize int
+	Elastics          []string
+	Index             string
+	KeepIndexVersions int
+	BulkSize          int
+	MappingDrift      string
 
 	// HTTP config
 	HTTPPort                int
 	GracefulShutdownTimeout int
 
+	// Geocoding config
+	Workers          int
+	KeepSubjectOrder bool
+	Geocoder         string
+	GazetteerPath    string
+
+	// Geocoding cache config
+	GeocodeCacheSize   int
+	GeocodeCacheStore  string
+	GeocodeCacheIndex  string
+	GeocodeNegativeTTL int
+
+	// Geocoding rate limiting and retries config
+	GeocodeRPS        float64
+	GeocodeBurst      int
+	GeocodeRetries    int
+	GeocodeBackoffMin int
+	GeocodeBackoffMax int
+
 	// Google maps api
-	APIKey string
+	APIKey      string
+	GoogleProxy string
 }
 
 // LoadConfig loads and unmarshal config from file passed as argument to func.
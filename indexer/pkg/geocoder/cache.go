@@ -0,0 +1,179 @@
+package geocoder
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// CacheEntry holds the cached result of a single lookup. Entries without
+// location are negative lookups and expire after the configured TTL.
+type CacheEntry struct {
+	Location *model.Location `json:"location,omitempty"`
+	Reason   string          `json:"reason,omitempty"`
+	Expires  time.Time       `json:"expires,omitempty"`
+}
+
+func (e *CacheEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+func (e *CacheEntry) result(location string) (*model.Location, error) {
+	if e.Location == nil {
+		return nil, &UnresolvedError{Location: location, Reason: e.Reason}
+	}
+
+	loc := *e.Location
+	return &loc, nil
+}
+
+// Store is a persistent tier of the cache shared by all indexer replicas.
+type Store interface {
+	// Get returns nil entry when key is not in store.
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	Put(ctx context.Context, key string, entry *CacheEntry) error
+}
+
+// CachedGeocoder puts in-process LRU and an optional persistent store in
+// front of another geocoder.
+type CachedGeocoder struct {
+	next        Geocoder
+	lru         *lru
+	store       Store
+	negativeTTL time.Duration
+	counter     *prometheus.CounterVec
+}
+
+// NewCached wraps the geocoder with cache. LRU is turned off when size is 0
+// and store is optional.
+func NewCached(next Geocoder, size int, store Store, negativeTTL time.Duration) *CachedGeocoder {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "http",
+			Name:      "requests_geocoder_cache_total",
+			Help:      "The total number of geocoding cache lookups.",
+		},
+		[]string{"tier", "result"},
+	)
+
+	prometheus.MustRegister(counter)
+
+	var cache *lru
+	if size > 0 {
+		cache = newLRU(size)
+	}
+
+	return &CachedGeocoder{next: next, lru: cache, store: store, negativeTTL: negativeTTL, counter: counter}
+}
+
+// Geocode returns cached result or asks the wrapped geocoder and caches its answer.
+func (c *CachedGeocoder) Geocode(ctx context.Context, location string) (*model.Location, error) {
+	key := cacheKey(location)
+	now := time.Now()
+
+	if c.lru != nil {
+		if e := c.lru.get(key); e != nil && !e.expired(now) {
+			c.counter.WithLabelValues("memory", "hit").Inc()
+			return e.result(location)
+		}
+		c.counter.WithLabelValues("memory", "miss").Inc()
+	}
+
+	if c.store != nil {
+		e, err := c.store.Get(ctx, key)
+		if err != nil {
+			log.Warn().Msgf("can't read geocoding cache store. err: %v", err)
+		}
+
+		if e != nil && !e.expired(now) {
+			c.counter.WithLabelValues("store", "hit").Inc()
+			if c.lru != nil {
+				c.lru.put(key, e)
+			}
+			return e.result(location)
+		}
+		c.counter.WithLabelValues("store", "miss").Inc()
+	}
+
+	loc, err := c.next.Geocode(ctx, location)
+	var e *CacheEntry
+	switch {
+	case err == nil:
+		e = &CacheEntry{Location: loc}
+	case IsUnresolved(err):
+		e = &CacheEntry{Reason: err.(*UnresolvedError).Reason, Expires: now.Add(c.negativeTTL)}
+	default:
+		// geocoder failures are not cached - the next lookup might succeed
+		return nil, err
+	}
+
+	if c.lru != nil {
+		c.lru.put(key, e)
+	}
+
+	if c.store != nil {
+		if err := c.store.Put(ctx, key, e); err != nil {
+			log.Warn().Msgf("can't write geocoding cache store. err: %v", err)
+		}
+	}
+
+	return loc, err
+}
+
+func cacheKey(location string) string {
+	return strings.ToLower(strings.Join(strings.Fields(location), " "))
+}
+
+// lru is a fixed size, concurrency safe, least recently used cache.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(key string) *CacheEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	l.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry
+}
+
+func (l *lru) put(key string, entry *CacheEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruItem).entry = entry
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruItem{key: key, entry: entry})
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+	}
+}
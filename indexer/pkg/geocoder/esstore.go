@@ -0,0 +1,76 @@
+package geocoder
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/olivere/elastic"
+)
+
+// ElasticStore keeps geocoding cache in a dedicated Elasticsearch index.
+type ElasticStore struct {
+	client *elastic.Client
+	index  string
+}
+
+type elasticEntry struct {
+	Query string `json:"query"`
+	CacheEntry
+}
+
+// NewElasticStore creates the store and its index if it doesn't exist yet.
+func NewElasticStore(client *elastic.Client, index string) (*ElasticStore, error) {
+	exists, err := client.IndexExists(index).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if _, err := client.CreateIndex(index).Do(context.Background()); err != nil && !elastic.IsConflict(err) {
+			return nil, err
+		}
+	}
+
+	return &ElasticStore{client: client, index: index}, nil
+}
+
+// Get returns cache entry stored under the key.
+func (s *ElasticStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	res, err := s.client.Get().Index(s.index).Type("entry").Id(docID(key)).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Found || res.Source == nil {
+		return nil, nil
+	}
+
+	var e elasticEntry
+	if err := json.Unmarshal(*res.Source, &e); err != nil {
+		return nil, err
+	}
+
+	return &e.CacheEntry, nil
+}
+
+// Put stores cache entry under the key.
+func (s *ElasticStore) Put(ctx context.Context, key string, entry *CacheEntry) error {
+	_, err := s.client.Index().
+		Index(s.index).
+		Type("entry").
+		Id(docID(key)).
+		BodyJson(elasticEntry{Query: key, CacheEntry: *entry}).
+		Do(ctx)
+	return err
+}
+
+// docID hashes the key as locations can be longer than allowed document ID.
+func docID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package geocoder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+)
+
+// place is a single gazetteer entry.
+type place struct {
+	name       string
+	admin      string
+	country    string
+	location   model.Location
+	population int
+}
+
+// GazetteerGeocoder resolves locations offline against a GeoNames-style
+// gazetteer file. Each non-comment line of the file holds tab separated
+// columns: name, alternate names (comma separated), admin area, country,
+// latitude, longitude and population.
+type GazetteerGeocoder struct {
+	places map[string][]*place
+}
+
+// NewGazetteer loads the gazetteer from file.
+func NewGazetteer(path string) (*GazetteerGeocoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := &GazetteerGeocoder{places: make(map[string][]*place)}
+
+	scanner := bufio.NewScanner(f)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cols := strings.Split(text, "\t")
+		if len(cols) != 7 {
+			return nil, fmt.Errorf("gazetteer %s:%d: expected 7 columns, got %d", path, line, len(cols))
+		}
+
+		p := &place{name: cols[0], admin: cols[2], country: cols[3]}
+		if p.location.Latitude, err = strconv.ParseFloat(cols[4], 64); err != nil {
+			return nil, fmt.Errorf("gazetteer %s:%d: wrong latitude: %v", path, line, err)
+		}
+		if p.location.Longitude, err = strconv.ParseFloat(cols[5], 64); err != nil {
+			return nil, fmt.Errorf("gazetteer %s:%d: wrong longitude: %v", path, line, err)
+		}
+		if cols[6] != "" {
+			if p.population, err = strconv.Atoi(cols[6]); err != nil {
+				return nil, fmt.Errorf("gazetteer %s:%d: wrong population: %v", path, line, err)
+			}
+		}
+
+		g.add(p.name, p)
+		for _, alt := range strings.Split(cols[1], ",") {
+			if alt != "" {
+				g.add(alt, p)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *GazetteerGeocoder) add(name string, p *place) {
+	key := gazetteerKey(name)
+	g.places[key] = append(g.places[key], p)
+}
+
+// Geocode resolves "place, region, country" style locations. It starts with
+// the most specific part and falls back to the less specific ones, so
+// "Off Cape Hatteras, North Carolina" resolves to North Carolina when the cape
+// itself is not in the gazetteer.
+func (g *GazetteerGeocoder) Geocode(ctx context.Context, location string) (*model.Location, error) {
+	if location == "" {
+		return nil, &UnresolvedError{Location: location, Reason: "empty location"}
+	}
+
+	parts := strings.Split(location, ",")
+	for i, part := range parts {
+		candidates := g.places[gazetteerKey(part)]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		best := bestPlace(candidates, parts[i+1:])
+		loc := best.location
+		return &loc, nil
+	}
+
+	return nil, &UnresolvedError{Location: location, Reason: "no gazetteer entry matches any part of the location"}
+}
+
+// bestPlace picks the candidate whose admin area or country is mentioned in
+// the remaining parts of the location. Population breaks the ties.
+func bestPlace(candidates []*place, rest []string) *place {
+	var best *place
+	var bestScore int
+	for _, c := range candidates {
+		var score int
+		for _, part := range rest {
+			key := gazetteerKey(part)
+			if key == gazetteerKey(c.admin) || key == gazetteerKey(c.country) {
+				score++
+			}
+		}
+
+		if best == nil || score > bestScore || (score == bestScore && c.population > best.population) {
+			best, bestScore = c, score
+		}
+	}
+
+	return best
+}
+
+func gazetteerKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,127 @@
+package geocoder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mateuszdyminski/auto/indexer/pkg/config"
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+)
+
+const (
+	// Google resolves locations with the Google Maps Geocoding API.
+	Google = "google"
+
+	// Gazetteer resolves locations offline against a bundled gazetteer file.
+	Gazetteer = "gazetteer"
+
+	// ElasticsearchStore keeps the shared geocoding cache in Elasticsearch.
+	ElasticsearchStore = "elasticsearch"
+)
+
+// Statuses of the geocoding requests. Apart from StatusFailed, which means
+// that the service couldn't be reached, they follow Google Maps API statuses.
+const (
+	StatusOK             = "OK"
+	StatusZeroResults    = "ZERO_RESULTS"
+	StatusOverQueryLimit = "OVER_QUERY_LIMIT"
+	StatusRequestDenied  = "REQUEST_DENIED"
+	StatusInvalidRequest = "INVALID_REQUEST"
+	StatusUnknownError   = "UNKNOWN_ERROR"
+	StatusFailed         = "ERROR"
+)
+
+// Geocoder turns a free-form crash location into GPS coordinates.
+type Geocoder interface {
+	// Geocode returns coordinates of the location. When the location can't be
+	// resolved the returned error is an *UnresolvedError.
+	Geocode(ctx context.Context, location string) (*model.Location, error)
+}
+
+// UnresolvedError is returned when the geocoder worked fine but couldn't find
+// the location.
+type UnresolvedError struct {
+	Location string
+	Reason   string
+}
+
+func (e *UnresolvedError) Error() string {
+	return fmt.Sprintf("can't resolve location %q: %s", e.Location, e.Reason)
+}
+
+// IsUnresolved reports whether err means that the location doesn't exist
+// rather than that the geocoder failed.
+func IsUnresolved(err error) bool {
+	_, ok := err.(*UnresolvedError)
+	return ok
+}
+
+// StatusError is returned when the geocoding service failed to answer.
+type StatusError struct {
+	Status string
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("geocoding failed with status %s: %v", e.Status, e.Err)
+}
+
+// Temporary reports whether the request might succeed when it's retried later.
+func (e *StatusError) Temporary() bool {
+	switch e.Status {
+	case StatusOverQueryLimit, StatusUnknownError, StatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTemporary reports whether err is worth retrying.
+func IsTemporary(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Temporary()
+}
+
+// New creates the geocoder selected in config. Google is used by default.
+// The geocoder is wrapped with cache when cache is turned on in config.
+func New(conf *config.Config) (Geocoder, error) {
+	var geo Geocoder
+	var err error
+	switch conf.Geocoder {
+	case "", Google:
+		geo, err = NewGoogle(conf)
+	case Gazetteer:
+		geo, err = NewGazetteer(conf.GazetteerPath)
+	default:
+		err = fmt.Errorf("unknown geocoder: %s", conf.Geocoder)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var store Store
+	switch conf.GeocodeCacheStore {
+	case "":
+	case ElasticsearchStore:
+		client, err := elastic.NewClient(elastic.SetURL(conf.Elastics...), elastic.SetSniff(false))
+		if err != nil {
+			return nil, err
+		}
+
+		if store, err = NewElasticStore(client, conf.GeocodeCacheIndex); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown geocoding cache store: %s", conf.GeocodeCacheStore)
+	}
+
+	geo = NewRetrying(geo, conf)
+
+	if conf.GeocodeCacheSize > 0 || store != nil {
+		geo = NewCached(geo, conf.GeocodeCacheSize, store, time.Duration(conf.GeocodeNegativeTTL)*time.Second)
+	}
+
+	return geo, nil
+}
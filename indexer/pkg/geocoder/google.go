@@ -0,0 +1,144 @@
+package geocoder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/mateuszdyminski/auto/indexer/pkg/config"
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"googlemaps.github.io/maps"
+)
+
+// GoogleGeocoder resolves locations with the Google Maps Geocoding API.
+type GoogleGeocoder struct {
+	client  *maps.Client
+	counter *prometheus.CounterVec
+}
+
+// NewGoogle creates Google Maps geocoder. Requests go through the HTTP proxy
+// when one is set in config.
+func NewGoogle(conf *config.Config) (*GoogleGeocoder, error) {
+	transport := http.DefaultTransport
+	if conf.GoogleProxy != "" {
+		proxyURL, err := url.Parse(conf.GoogleProxy)
+		if err != nil {
+			return nil, err
+		}
+
+		transport = &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	client, err := maps.NewClient(
+		maps.WithAPIKey(conf.APIKey),
+		maps.WithHTTPClient(&http.Client{Transport: &statusTransport{next: transport}}))
+	if err != nil {
+		return nil, err
+	}
+
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "http",
+			Name:      "requests_google_api_total",
+			Help:      "The total number of Google API requests.",
+		},
+		[]string{"status"},
+	)
+
+	prometheus.MustRegister(counter)
+
+	return &GoogleGeocoder{client: client, counter: counter}, nil
+}
+
+// Geocode asks Google Maps API for the coordinates of the location.
+func (g *GoogleGeocoder) Geocode(ctx context.Context, location string) (*model.Location, error) {
+	if location == "" {
+		return nil, &UnresolvedError{Location: location, Reason: "empty location"}
+	}
+
+	var apiStatus string
+	ctx = context.WithValue(ctx, statusKey{}, &apiStatus)
+
+	geo, err := g.client.Geocode(ctx, &maps.GeocodingRequest{Address: location})
+	status := googleStatus(apiStatus, err)
+	g.counter.WithLabelValues(status).Inc()
+
+	switch {
+	case status == StatusZeroResults:
+		return nil, &UnresolvedError{Location: location, Reason: "no results from Google API"}
+	case err != nil:
+		return nil, &StatusError{Status: status, Err: err}
+	case len(geo) == 0:
+		return nil, &UnresolvedError{Location: location, Reason: "no results from Google API"}
+	}
+
+	return &model.Location{
+		Latitude:  geo[0].Geometry.Location.Lat,
+		Longitude: geo[0].Geometry.Location.Lng,
+	}, nil
+}
+
+// statusKey is the context key of the status captured by statusTransport.
+type statusKey struct{}
+
+// statusTransport captures the status of the Google API response, so the
+// errors can be told apart without relying on their messages.
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	status, ok := req.Context().Value(statusKey{}).(*string)
+	if !ok {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		*status = payload.Status
+	}
+
+	return res, nil
+}
+
+// googleStatus returns the Google API status captured from the response.
+// The client doesn't fail on ZERO_RESULTS, so the captured status goes first
+// and OK or StatusFailed are only derived from the error when there is none.
+func googleStatus(status string, err error) string {
+	switch status {
+	case StatusOK:
+		if err != nil {
+			return StatusFailed
+		}
+		return StatusOK
+	case StatusZeroResults, StatusOverQueryLimit, StatusRequestDenied, StatusInvalidRequest, StatusUnknownError:
+		return status
+	}
+
+	if err == nil {
+		return StatusOK
+	}
+	return StatusFailed
+}
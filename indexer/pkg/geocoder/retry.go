@@ -0,0 +1,98 @@
+package geocoder
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/mateuszdyminski/auto/indexer/pkg/config"
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// RetryingGeocoder limits the rate of requests sent to another geocoder and
+// retries the temporary failures with exponential backoff and full jitter.
+type RetryingGeocoder struct {
+	next       Geocoder
+	limiter    *rate.Limiter
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	counter    *prometheus.CounterVec
+}
+
+// NewRetrying wraps the geocoder with per-replica token bucket rate limiter
+// and retries. Rate isn't limited when GeocodeRPS is not set.
+func NewRetrying(next Geocoder, conf *config.Config) *RetryingGeocoder {
+	limit := rate.Inf
+	if conf.GeocodeRPS > 0 {
+		limit = rate.Limit(conf.GeocodeRPS)
+	}
+
+	burst := conf.GeocodeBurst
+	if burst < 1 {
+		burst = 1
+	}
+
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "geocoder",
+			Name:      "retries_total",
+			Help:      "The total number of retried geocoding requests.",
+		},
+		[]string{"status"},
+	)
+
+	prometheus.MustRegister(counter)
+
+	return &RetryingGeocoder{
+		next:       next,
+		limiter:    rate.NewLimiter(limit, burst),
+		retries:    conf.GeocodeRetries,
+		minBackoff: time.Duration(conf.GeocodeBackoffMin) * time.Millisecond,
+		maxBackoff: time.Duration(conf.GeocodeBackoffMax) * time.Millisecond,
+		counter:    counter,
+	}
+}
+
+// Geocode waits for the token and asks the wrapped geocoder. Temporary
+// failures are retried up to the configured number of times.
+func (r *RetryingGeocoder) Geocode(ctx context.Context, location string) (*model.Location, error) {
+	for attempt := 0; ; attempt++ {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		loc, err := r.next.Geocode(ctx, location)
+		if err == nil || !IsTemporary(err) || attempt >= r.retries {
+			return loc, err
+		}
+
+		r.counter.WithLabelValues(err.(*StatusError).Status).Inc()
+
+		wait := r.backoff(attempt)
+		log.Debug().Msgf("geocoding of %s failed, retrying in %v. err: %v", location, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff returns random duration between 0 and min(maxBackoff, minBackoff * 2^attempt).
+func (r *RetryingGeocoder) backoff(attempt int) time.Duration {
+	ceil := r.minBackoff << uint(attempt)
+	if ceil <= 0 || (r.maxBackoff > 0 && ceil > r.maxBackoff) {
+		ceil = r.maxBackoff
+	}
+
+	if ceil <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceil)))
+}
@@ -0,0 +1,50 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic"
+)
+
+// Versioned returns the name of the concrete index of given version, e.g. flights-v3.
+func Versioned(alias string, version int) string {
+	return fmt.Sprintf("%s-v%d", alias, version)
+}
+
+// Versions returns sorted versions of all existing concrete indices of the alias.
+func Versions(ctx context.Context, client *elastic.Client, alias string) ([]int, error) {
+	names, err := client.IndexNames()
+	if err != nil {
+		return nil, fmt.Errorf("can't list indices: %v", err)
+	}
+
+	var versions []int
+	for _, name := range names {
+		if !strings.HasPrefix(name, alias+"-v") {
+			continue
+		}
+
+		v, err := strconv.Atoi(strings.TrimPrefix(name, alias+"-v"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// aliased returns concrete indices the alias points to.
+func aliased(ctx context.Context, client *elastic.Client, alias string) ([]string, error) {
+	res, err := client.Aliases().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get aliases: %v", err)
+	}
+
+	return res.IndicesByAlias(alias), nil
+}
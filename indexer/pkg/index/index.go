@@ -0,0 +1,164 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
+)
+
+// Policies applied when the live mapping has drifted from the template.
+const (
+	DriftWarn = "warn"
+	DriftFail = "fail"
+)
+
+// Setup installs the index template and makes sure the alias points to
+// a versioned index, creating the first version when there is none. Mapping
+// of the live index is compared with the template and the drift is logged or
+// returned as error, depending on the policy.
+func Setup(ctx context.Context, client *elastic.Client, alias, driftPolicy string) error {
+	if err := PutTemplate(ctx, client, alias); err != nil {
+		return err
+	}
+
+	indices, err := aliased(ctx, client, alias)
+	if err != nil {
+		return err
+	}
+
+	if len(indices) == 0 {
+		exists, err := client.IndexExists(alias).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("can't check if index exists: %v", err)
+		}
+
+		if exists {
+			log.Warn().Msgf("'%s' is a concrete index, not an alias. Run reindex command to move it to versioned index", alias)
+		} else {
+			name := Versioned(alias, 1)
+			log.Info().Msgf("Creating index '%s' with alias '%s'", name, alias)
+			_, err := client.CreateIndex(name).
+				BodyJson(map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}}).
+				Do(ctx)
+			if err != nil {
+				return fmt.Errorf("can't create index: %v", err)
+			}
+			return nil
+		}
+	}
+
+	drift, err := Drift(ctx, client, alias)
+	if err != nil {
+		return err
+	}
+
+	if len(drift) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("mapping of index '%s' has drifted from template version %d: %s", alias, TemplateVersion, strings.Join(drift, "; "))
+	if driftPolicy == DriftFail {
+		return errors.New(msg)
+	}
+
+	log.Warn().Msg(msg)
+	return nil
+}
+
+// PutTemplate installs the current version of the index template of the
+// alias. Template is named after the alias.
+func PutTemplate(ctx context.Context, client *elastic.Client, alias string) error {
+	if _, err := client.IndexPutTemplate(alias).BodyString(Template(alias)).Do(ctx); err != nil {
+		return fmt.Errorf("can't put index template: %v", err)
+	}
+
+	log.Info().Msgf("Index template '%s' version %d installed", alias, TemplateVersion)
+	return nil
+}
+
+// Drift returns the fields whose type in the live mapping of the index is
+// different than in the template.
+func Drift(ctx context.Context, client *elastic.Client, name string) ([]string, error) {
+	var tpl struct {
+		Mappings map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(Template(name)), &tpl); err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]string)
+	flatten("", tpl.Mappings["flight"].Properties, expected)
+
+	res, err := client.GetMapping().Index(name).Type("flight").Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get mapping: %v", err)
+	}
+
+	// response is keyed by concrete index name: {"index": {"mappings": {"flight": {"properties": {...}}}}}
+	live := make(map[string]string)
+	for _, idx := range res {
+		mappings, _ := path(idx, "mappings", "flight", "properties")
+		flatten("", mappings, live)
+	}
+
+	var drift []string
+	for field, typ := range expected {
+		got, ok := live[field]
+		if !ok {
+			got = "missing"
+		}
+
+		if got != typ {
+			drift = append(drift, fmt.Sprintf("%s: expected %s, got %s", field, typ, got))
+		}
+	}
+
+	sort.Strings(drift)
+	return drift, nil
+}
+
+// flatten collects types of all fields, including sub-fields and multi-fields,
+// keyed by their dotted path.
+func flatten(prefix string, props map[string]interface{}, out map[string]string) {
+	for name, v := range props {
+		field, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		typ, _ := field["type"].(string)
+		if typ == "" {
+			typ = "object"
+		}
+		out[prefix+name] = typ
+
+		if sub, ok := field["properties"].(map[string]interface{}); ok {
+			flatten(prefix+name+".", sub, out)
+		}
+		if sub, ok := field["fields"].(map[string]interface{}); ok {
+			flatten(prefix+name+".", sub, out)
+		}
+	}
+}
+
+// path walks down the nested JSON objects.
+func path(v interface{}, keys ...string) (map[string]interface{}, bool) {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v = m[key]
+	}
+
+	m, ok := v.(map[string]interface{})
+	return m, ok
+}
@@ -0,0 +1,175 @@
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
+)
+
+// Reindex creates new versioned index from the current template, copies all
+// documents from the index behind the alias, checks the document counts and
+// atomically swaps the alias. Documents written to the old index during the
+// copy are picked up by the catch-up pass. Only keep newest old versions are
+// left for rollback. It returns the name of the new index.
+func Reindex(ctx context.Context, client *elastic.Client, alias string, keep int) (string, error) {
+	if err := PutTemplate(ctx, client, alias); err != nil {
+		return "", err
+	}
+
+	sources, err := aliased(ctx, client, alias)
+	if err != nil {
+		return "", err
+	}
+
+	// alias might still be the concrete index created before versioning
+	legacy := len(sources) == 0
+	if legacy {
+		sources = []string{alias}
+	}
+
+	versions, err := Versions(ctx, client, alias)
+	if err != nil {
+		return "", err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+	target := Versioned(alias, next)
+
+	log.Info().Msgf("Reindexing %v into '%s'", sources, target)
+	if _, err := client.CreateIndex(target).Do(ctx); err != nil {
+		return "", fmt.Errorf("can't create index %s: %v", target, err)
+	}
+
+	// indexer keeps writing to the sources, so the copy is checked against
+	// the documents which existed before it started
+	want, err := count(ctx, client, sources...)
+	if err != nil {
+		return "", err
+	}
+
+	if err := copyDocs(ctx, client, sources, target); err != nil {
+		return "", err
+	}
+
+	if err := checkCount(ctx, client, target, want); err != nil {
+		client.DeleteIndex(target).Do(ctx)
+		return "", err
+	}
+
+	if legacy {
+		// the legacy index is gone with the swap, so it's caught up before
+		if err := copyDocs(ctx, client, sources, target); err != nil {
+			return "", err
+		}
+
+		// alias can't have the same name as the index, so the legacy index is
+		// removed in the same atomic action which creates the alias
+		_, err := client.Alias().
+			Action(elastic.NewAliasRemoveIndexAction(alias)).
+			Add(target, alias).
+			Do(ctx)
+		if err != nil {
+			return "", fmt.Errorf("can't replace legacy index %s with alias: %v", alias, err)
+		}
+	} else {
+		swap := client.Alias().Add(target, alias)
+		for _, src := range sources {
+			swap = swap.Remove(src, alias)
+		}
+
+		if _, err := swap.Do(ctx); err != nil {
+			return "", fmt.Errorf("can't swap alias %s: %v", alias, err)
+		}
+
+		// catch up with documents indexed into the old index during the copy
+		if err := copyDocs(ctx, client, sources, target); err != nil {
+			return "", err
+		}
+	}
+
+	log.Info().Msgf("Alias '%s' points to '%s'", alias, target)
+
+	return target, prune(ctx, client, alias, next, keep)
+}
+
+// copyDocs copies documents with reindex API. Documents keep their versions
+// (external versioning), so repeated copy creates the missing documents,
+// overwrites the ones updated since the previous copy and skips the rest.
+func copyDocs(ctx context.Context, client *elastic.Client, sources []string, target string) error {
+	res, err := client.Reindex().
+		Source(elastic.NewReindexSource().Index(sources...)).
+		Destination(elastic.NewReindexDestination().Index(target).VersionType("external")).
+		Conflicts("proceed").
+		Refresh("true").
+		WaitForCompletion(true).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("can't reindex %v into %s: %v", sources, target, err)
+	}
+
+	if len(res.Failures) > 0 {
+		return fmt.Errorf("reindex %v into %s failed for %d documents: %+v", sources, target, len(res.Failures), res.Failures[0])
+	}
+
+	log.Info().Msgf("Copied documents into '%s'. Created: %d, updated: %d, up to date: %d", target, res.Created, res.Updated, res.VersionConflicts)
+	return nil
+}
+
+// count returns the number of documents in the indices after refreshing them.
+func count(ctx context.Context, client *elastic.Client, indices ...string) (int64, error) {
+	if _, err := client.Refresh(indices...).Do(ctx); err != nil {
+		return 0, fmt.Errorf("can't refresh %v: %v", indices, err)
+	}
+
+	n, err := client.Count(indices...).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("can't count documents in %v: %v", indices, err)
+	}
+
+	return n, nil
+}
+
+// checkCount checks whether target has at least want documents.
+func checkCount(ctx context.Context, client *elastic.Client, target string, want int64) error {
+	got, err := count(ctx, client, target)
+	if err != nil {
+		return err
+	}
+
+	if got < want {
+		return fmt.Errorf("index %s has %d documents, expected at least %d", target, got, want)
+	}
+
+	return nil
+}
+
+// prune deletes old versions of the index except the keep newest ones.
+func prune(ctx context.Context, client *elastic.Client, alias string, current, keep int) error {
+	versions, err := Versions(ctx, client, alias)
+	if err != nil {
+		return err
+	}
+
+	var old []int
+	for _, v := range versions {
+		if v < current {
+			old = append(old, v)
+		}
+	}
+
+	for len(old) > keep {
+		name := Versioned(alias, old[0])
+		log.Info().Msgf("Deleting old index '%s'", name)
+		if _, err := client.DeleteIndex(name).Do(ctx); err != nil {
+			return fmt.Errorf("can't delete index %s: %v", name, err)
+		}
+		old = old[1:]
+	}
+
+	return nil
+}
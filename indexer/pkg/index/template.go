@@ -0,0 +1,85 @@
+package index
+
+import "fmt"
+
+// TemplateVersion must be bumped on every change of the template.
+const TemplateVersion = 2
+
+// Template returns body of the index template applied to the indices of the
+// alias, including its versions.
+func Template(alias string) string {
+	return fmt.Sprintf(template, alias+"*", TemplateVersion)
+}
+
+// template is applied to all flights indices. Aboard and fatalities are nested
+// but also copied into the root document, so they can be filtered and
+// aggregated without nested queries.
+const template = `{
+  "index_patterns": [%q],
+  "version": %d,
+  "settings": {
+    "number_of_shards": 1
+  },
+  "mappings": {
+    "flight": {
+      "properties": {
+        "id": { "type": "keyword" },
+        "date": { "type": "date" },
+        "timeUnknown": { "type": "boolean" },
+        "timeZone": { "type": "keyword" },
+        "location": {
+          "type": "text",
+          "fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+        },
+        "locationParts": {
+          "properties": {
+            "normalized": {
+              "type": "text",
+              "fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+            },
+            "qualifier": { "type": "keyword" },
+            "place": { "type": "keyword" },
+            "region": { "type": "keyword" },
+            "country": { "type": "keyword" }
+          }
+        },
+        "operator": {
+          "type": "text",
+          "fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+        },
+        "flightNo": { "type": "keyword" },
+        "route": {
+          "type": "text",
+          "fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+        },
+        "aircraftType": {
+          "type": "text",
+          "fields": { "keyword": { "type": "keyword", "ignore_above": 256 } }
+        },
+        "registration": { "type": "keyword" },
+        "serialNumber": { "type": "keyword" },
+        "aboard": {
+          "type": "nested",
+          "include_in_root": true,
+          "properties": {
+            "total": { "type": "integer" },
+            "crew": { "type": "integer" },
+            "passengers": { "type": "integer" }
+          }
+        },
+        "fatalities": {
+          "type": "nested",
+          "include_in_root": true,
+          "properties": {
+            "total": { "type": "integer" },
+            "crew": { "type": "integer" },
+            "passengers": { "type": "integer" }
+          }
+        },
+        "ground": { "type": "integer" },
+        "summary": { "type": "text", "analyzer": "english" },
+        "locationGPS": { "type": "geo_point" }
+      }
+    }
+  }
+}`
@@ -2,28 +2,37 @@ package indexer
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
-	"net/http"
-	"net/url"
 	"sync"
+	"time"
 
 	"github.com/mateuszdyminski/auto/indexer/pkg/config"
+	"github.com/mateuszdyminski/auto/indexer/pkg/geocoder"
+	"github.com/mateuszdyminski/auto/indexer/pkg/index"
 	"github.com/mateuszdyminski/auto/ingress/model"
 	nats "github.com/nats-io/go-nats"
 	"github.com/olivere/elastic"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
-	uuid "github.com/satori/go.uuid"
-	"googlemaps.github.io/maps"
 )
 
+// DeadLetter is published to the dead-letter topic when flight crash can't be
+// geocoded. Unresolved is set when geocoder worked fine but the location
+// wasn't found, so retrying it won't help.
+type DeadLetter struct {
+	Flight     model.FlightCrash `json:"flight"`
+	Reason     string            `json:"reason"`
+	Unresolved bool              `json:"unresolved"`
+	Time       time.Time         `json:"time"`
+}
+
 type Indexer struct {
-	nc               *nats.Conn
-	conf             *config.Config
-	ctx              *context.Context
-	googleAPIcounter *prometheus.CounterVec
-	mapClient        *maps.Client
+	nc         *nats.Conn
+	conf       *config.Config
+	ctx        *context.Context
+	geocoder   geocoder.Geocoder
+	inFlight   prometheus.Gauge
+	duplicates prometheus.Counter
 }
 
 func NewIndexer(conf *config.Config) (*Indexer, error) {
@@ -32,79 +41,52 @@ func NewIndexer(conf *config.Config) (*Indexer, error) {
 		return nil, err
 	}
 
-	proxyUrl, _ := url.Parse("http://10.144.1.10:8080")
-	myClient := &http.Client{Transport: &http.Transport{
-		Proxy:           http.ProxyURL(proxyUrl),
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}}
-	mapClient, err := maps.NewClient(maps.WithAPIKey(conf.APIKey), maps.WithHTTPClient(myClient))
+	geo, err := geocoder.New(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	counter := prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Subsystem: "http",
-			Name:      "requests_google_api_total",
-			Help:      "The total number of Google API requests.",
-		},
-		[]string{"status"},
-	)
+	// used for horizontal pod auto-scaling on workers saturation
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "geocoder",
+		Name:      "inflight_requests",
+		Help:      "The number of geocoding lookups in progress.",
+	})
 
-	prometheus.MustRegister(counter)
+	duplicates := prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "indexer",
+		Name:      "duplicates_total",
+		Help:      "The total number of flight crashes which were already indexed.",
+	})
 
-	return &Indexer{nc: nc, conf: conf, mapClient: mapClient, googleAPIcounter: counter}, nil
+	prometheus.MustRegister(inFlight)
+	prometheus.MustRegister(duplicates)
+
+	return &Indexer{nc: nc, conf: conf, geocoder: geo, inFlight: inFlight, duplicates: duplicates}, nil
 }
 
 func (i *Indexer) Start(cancelCtx context.Context) {
 	log.Info().Msg("Start indexing flights...")
-	i.indexFlights(i.streamFlights(cancelCtx))
+	i.indexFlights(i.geocodeFlights(i.streamFlights(cancelCtx)))
 }
 
+// indexFlights is the bulk writer shared by all geocoding workers.
 func (i *Indexer) indexFlights(flights chan model.FlightCrash) {
 	// connect to the cluster
-	client, err := elastic.NewClient(elastic.SetURL(i.conf.Elastics...), elastic.SetSniff(false))
+	client, err := i.elasticClient()
 	if err != nil {
 		log.Fatal().Msgf("Can't create elastic client. Err: %v", err)
 	}
 
-	exists, err := client.IndexExists("flights").Do(context.Background())
-	if err != nil {
-		log.Fatal().Msgf("Can't check if index exists. Err: %v", err)
-	}
-
-	if !exists {
-		log.Info().Msg("Creating index 'flights'")
-		// Create an index if not exists
-		_, err = client.
-			CreateIndex("flights").
-			Do(context.Background())
-		if err != nil {
-			log.Fatal().Msgf("Can't create index. Err: %v", err)
-		}
+	if err := index.Setup(context.Background(), client, i.conf.Index, i.conf.MappingDrift); err != nil {
+		log.Fatal().Msgf("Can't set up index. Err: %v", err)
 	}
 
 	var enqued int
 	bulkRequest := client.Bulk()
 	for flight := range flights {
-		log.Info().Msgf("Got flight crash: %+v", flight)
-
-		// get coordinates from google maps API
-		coordinates, err := i.coordinates(flight)
-		if err == nil && coordinates != nil {
-			flight.LocationGPS = coordinates
-			data, err := json.Marshal(flight)
-			if err != nil {
-				log.Error().Msgf("can't marshal flight with coordinates. err: %v", err)
-			} else {
-				i.nc.Publish(i.conf.OutTopic, data)
-			}
-		} else {
-			log.Error().Msgf("can't find gps coordinates for location: %s. err %+v", flight.Location, err)
-		}
-
 		if enqued > 0 && enqued%i.conf.BulkSize == 0 {
-			if _, err := bulkRequest.Do(context.Background()); err != nil {
+			if err := i.executeBulk(bulkRequest); err != nil {
 				log.Fatal().Msgf("Can't execute bulk. Err: %v", err)
 			}
 
@@ -113,49 +95,97 @@ func (i *Indexer) indexFlights(flights chan model.FlightCrash) {
 			bulkRequest = client.Bulk()
 		}
 
+		// upsert makes re-ingestion and NATS redeliveries idempotent
 		bulkRequest.Add(
-			elastic.NewBulkIndexRequest().
-				Index("flights").
+			elastic.NewBulkUpdateRequest().
+				Index(i.conf.Index).
 				Type("flight").
-				Id(uuid.Must(uuid.NewV4()).String()).
-				Doc(flight))
+				Id(flight.ID).
+				Doc(flight).
+				DocAsUpsert(true))
 
 		enqued++
 	}
 
 	if bulkRequest.NumberOfActions() > 0 {
-		if _, err := bulkRequest.Do(context.Background()); err != nil {
+		if err := i.executeBulk(bulkRequest); err != nil {
 			log.Fatal().Msgf("Can't execute bulk. Err: %v", err)
 		}
 	}
 }
 
-func (i *Indexer) coordinates(flight model.FlightCrash) (*model.Location, error) {
+// executeBulk executes bulk of upserts and counts the flights which were
+// already indexed.
+func (i *Indexer) executeBulk(bulkRequest *elastic.BulkService) error {
+	res, err := bulkRequest.Do(context.Background())
+	if err != nil {
+		return err
+	}
 
-	r := &maps.GeocodingRequest{
-		Address: flight.Location,
+	for _, item := range res.Updated() {
+		switch {
+		case item.Error != nil:
+			log.Error().Msgf("Can't index flight %s. Err: %+v", item.Id, item.Error)
+		case item.Result != "created":
+			i.duplicates.Inc()
+		}
 	}
 
-	geo, err := i.mapClient.Geocode(context.Background(), r)
+	return nil
+}
+
+// Reindex moves all flights into new versioned index and swaps the alias.
+func (i *Indexer) Reindex(ctx context.Context) error {
+	client, err := i.elasticClient()
 	if err != nil {
-		i.googleAPIcounter.WithLabelValues("500").Inc()
-		return nil, err
+		return err
 	}
 
-	i.googleAPIcounter.WithLabelValues("200").Inc()
+	_, err = index.Reindex(ctx, client, i.conf.Index, i.conf.KeepIndexVersions)
+	return err
+}
+
+func (i *Indexer) elasticClient() (*elastic.Client, error) {
+	return elastic.NewClient(elastic.SetURL(i.conf.Elastics...), elastic.SetSniff(false))
+}
+
+// deadLetter publishes the flight which can't be geocoded to the dead-letter topic.
+func (i *Indexer) deadLetter(flight model.FlightCrash, reason error) {
+	if i.conf.DeadLetterTopic == "" {
+		return
+	}
 
-	if len(geo) > 0 {
-		return &model.Location{
-			Latitude:  geo[0].Geometry.Location.Lat,
-			Longitude: geo[0].Geometry.Location.Lng,
-		}, nil
+	data, err := json.Marshal(DeadLetter{
+		Flight:     flight,
+		Reason:     reason.Error(),
+		Unresolved: geocoder.IsUnresolved(reason),
+		Time:       time.Now(),
+	})
+	if err != nil {
+		log.Error().Msgf("can't marshal dead letter. err: %v", err)
+		return
+	}
+
+	if err := i.nc.Publish(i.conf.DeadLetterTopic, data); err != nil {
+		log.Error().Msgf("can't publish dead letter to topic: %s. err: %v", i.conf.DeadLetterTopic, err)
+	}
+}
+
+// coordinates geocodes the normalized location first and falls back to the
+// original one when the normalized form can't be resolved.
+func (i *Indexer) coordinates(flight model.FlightCrash) (*model.Location, error) {
+	if flight.LocationParts != nil && flight.LocationParts.Normalized != "" && flight.LocationParts.Normalized != flight.Location {
+		loc, err := i.geocoder.Geocode(context.Background(), flight.LocationParts.Normalized)
+		if !geocoder.IsUnresolved(err) {
+			return loc, err
+		}
 	}
 
-	return nil, nil
+	return i.geocoder.Geocode(context.Background(), flight.Location)
 }
 
-func (i *Indexer) streamFlights(ctx context.Context) chan model.FlightCrash {
-	out := make(chan model.FlightCrash)
+func (i *Indexer) streamFlights(ctx context.Context) chan message {
+	out := make(chan message)
 
 	var mu sync.Mutex
 	go func() {
@@ -167,7 +197,7 @@ func (i *Indexer) streamFlights(ctx context.Context) chan model.FlightCrash {
 			}
 
 			mu.Lock()
-			out <- flight
+			out <- message{subject: m.Subject, flight: flight}
 			mu.Unlock()
 		})
 
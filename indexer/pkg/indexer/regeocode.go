@@ -0,0 +1,97 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/mateuszdyminski/auto/indexer/pkg/normalize"
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
+)
+
+// Regeocode scans the flights index for crashes without coordinates, geocodes
+// them again and updates them in place. Crashes which got coordinates are
+// published to the out topic, so they finally show up on the map.
+func (i *Indexer) Regeocode(ctx context.Context) error {
+	client, err := i.elasticClient()
+	if err != nil {
+		return err
+	}
+
+	missing := elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("locationGPS"))
+	scroll := client.Scroll(i.conf.Index).Type("flight").Query(missing).Size(i.conf.BulkSize)
+	defer scroll.Clear(context.Background())
+
+	var resolved, failed int
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		bulkRequest := client.Bulk()
+		updated := make(map[string]model.FlightCrash)
+		for _, hit := range res.Hits.Hits {
+			var flight model.FlightCrash
+			if err := json.Unmarshal(*hit.Source, &flight); err != nil {
+				return err
+			}
+
+			flight.LocationParts = normalize.Location(flight.Location)
+			coordinates, err := i.coordinates(flight)
+			if err != nil {
+				log.Warn().Msgf("still can't find gps coordinates for location: %s. err: %v", flight.Location, err)
+				failed++
+				continue
+			}
+
+			flight.LocationGPS = coordinates
+			bulkRequest.Add(
+				elastic.NewBulkUpdateRequest().
+					Index(i.conf.Index).
+					Type("flight").
+					Id(hit.Id).
+					Doc(map[string]interface{}{
+						"locationGPS":   flight.LocationGPS,
+						"locationParts": flight.LocationParts,
+					}))
+
+			flight.ID = hit.Id
+			updated[hit.Id] = flight
+		}
+
+		if bulkRequest.NumberOfActions() > 0 {
+			bulkRes, err := bulkRequest.Do(ctx)
+			if err != nil {
+				return err
+			}
+
+			// only the crashes updated in the index are published
+			for _, item := range bulkRes.Updated() {
+				if item.Error != nil {
+					log.Error().Msgf("Can't update flight %s. Err: %+v", item.Id, item.Error)
+					failed++
+					continue
+				}
+
+				if data, err := json.Marshal(updated[item.Id]); err != nil {
+					log.Error().Msgf("can't marshal flight with coordinates. err: %v", err)
+				} else {
+					i.nc.Publish(i.conf.OutTopic, data)
+				}
+
+				resolved++
+			}
+		}
+
+		log.Info().Msgf("Re-geocoding in progress. Resolved: %d, still missing: %d", resolved, failed)
+	}
+
+	log.Info().Msgf("Re-geocoding done! Resolved: %d, still missing: %d", resolved, failed)
+	return i.nc.Flush()
+}
@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mateuszdyminski/auto/indexer/pkg/normalize"
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/rs/zerolog/log"
+)
+
+// message is a flight crash received from NATS together with its subject.
+type message struct {
+	subject string
+	flight  model.FlightCrash
+}
+
+// geocodeFlights geocodes flights with the pool of workers and passes them to
+// the returned channel. When KeepSubjectOrder is set, all flights of a subject
+// are handled by the same worker, so they leave the pool in the order they
+// came in. It only spreads the work when Topic is a wildcard subject.
+func (i *Indexer) geocodeFlights(messages chan message) chan model.FlightCrash {
+	workers := i.conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	out := make(chan model.FlightCrash, workers)
+
+	inputs := make([]chan message, workers)
+	for w := range inputs {
+		if i.conf.KeepSubjectOrder {
+			inputs[w] = make(chan message)
+		} else {
+			// all workers share single input channel
+			inputs[w] = messages
+		}
+	}
+
+	if i.conf.KeepSubjectOrder {
+		go func() {
+			for m := range messages {
+				h := fnv.New32a()
+				h.Write([]byte(m.subject))
+				inputs[h.Sum32()%uint32(workers)] <- m
+			}
+
+			for _, in := range inputs {
+				close(in)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(in chan message) {
+			defer wg.Done()
+			for m := range in {
+				out <- i.geocode(m.flight)
+			}
+		}(inputs[w])
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	log.Info().Msgf("Started %d geocoding workers", workers)
+	return out
+}
+
+// geocode normalizes flight location and finds its coordinates. Flights with
+// coordinates are published to the out topic, the rest to the dead-letter one.
+func (i *Indexer) geocode(flight model.FlightCrash) model.FlightCrash {
+	log.Info().Msgf("Got flight crash: %+v", flight)
+
+	if flight.ID == "" {
+		flight.ID = flight.NaturalID()
+	}
+
+	i.inFlight.Inc()
+	defer i.inFlight.Dec()
+
+	flight.LocationParts = normalize.Location(flight.Location)
+	coordinates, err := i.coordinates(flight)
+	if err != nil {
+		log.Error().Msgf("can't find gps coordinates for location: %s. err: %v", flight.Location, err)
+		i.deadLetter(flight, err)
+		return flight
+	}
+
+	flight.LocationGPS = coordinates
+	data, err := json.Marshal(flight)
+	if err != nil {
+		log.Error().Msgf("can't marshal flight with coordinates. err: %v", err)
+	} else {
+		i.nc.Publish(i.conf.OutTopic, data)
+	}
+
+	return flight
+}
@@ -0,0 +1,210 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+)
+
+// UnitedStates is the country set for locations which end with a US state.
+const UnitedStates = "United States"
+
+// qualifiers are the words describing the position relative to the place,
+// e.g. "Near Chetumal, Mexico" or "Off Cape Hatteras, North Carolina".
+var qualifiers = regexp.MustCompile(`(?i)^(near|off the coast of|off|over the|over|outside of|outside|about|approximately)\s+`)
+
+// states maps US state abbreviations onto full state names. Abbreviations
+// which are common words (in, me, or, la, de) are left out.
+var states = map[string]string{
+	"al": "Alabama", "ala": "Alabama",
+	"ak": "Alaska",
+	"az": "Arizona", "ariz": "Arizona",
+	"ar": "Arkansas", "ark": "Arkansas",
+	"ca": "California", "calif": "California",
+	"co": "Colorado", "colo": "Colorado",
+	"ct": "Connecticut", "conn": "Connecticut",
+	"del": "Delaware",
+	"fl":  "Florida", "fla": "Florida",
+	"ga": "Georgia",
+	"hi": "Hawaii",
+	"id": "Idaho",
+	"il": "Illinois", "ill": "Illinois",
+	"ind": "Indiana",
+	"ia":  "Iowa",
+	"ks":  "Kansas", "kan": "Kansas",
+	"ky": "Kentucky",
+	"md": "Maryland",
+	"ma": "Massachusetts", "mass": "Massachusetts",
+	"mi": "Michigan", "mich": "Michigan",
+	"mn": "Minnesota", "minn": "Minnesota",
+	"ms": "Mississippi", "miss": "Mississippi",
+	"mo": "Missouri",
+	"mt": "Montana", "mont": "Montana",
+	"ne": "Nebraska", "neb": "Nebraska",
+	"nv": "Nevada", "nev": "Nevada",
+	"nh": "New Hampshire",
+	"nj": "New Jersey",
+	"nm": "New Mexico",
+	"ny": "New York",
+	"nc": "North Carolina",
+	"nd": "North Dakota",
+	"oh": "Ohio",
+	"ok": "Oklahoma", "okla": "Oklahoma",
+	"ore": "Oregon",
+	"pa":  "Pennsylvania", "penn": "Pennsylvania",
+	"ri": "Rhode Island",
+	"sc": "South Carolina",
+	"sd": "South Dakota",
+	"tn": "Tennessee", "tenn": "Tennessee",
+	"tx": "Texas", "tex": "Texas",
+	"ut": "Utah",
+	"vt": "Vermont",
+	"va": "Virginia",
+	"wa": "Washington", "wash": "Washington",
+	"wv": "West Virginia",
+	"wi": "Wisconsin", "wis": "Wisconsin",
+	"wy": "Wyoming", "wyo": "Wyoming",
+}
+
+// stateNames is the set of full US state names.
+var stateNames = make(map[string]string)
+
+func init() {
+	for _, name := range states {
+		stateNames[strings.ToLower(name)] = name
+	}
+	// abbreviated only with the common words
+	stateNames["louisiana"] = "Louisiana"
+	stateNames["maine"] = "Maine"
+}
+
+// Georgia is both the US state and the country. Locations ending with it are
+// resolved by the place, unknown places are left ambiguous.
+const Georgia = "Georgia"
+
+// georgiaUS are the places in the US state found in the crash data.
+var georgiaUS = []string{
+	"albany", "alma", "athens", "atlanta", "augusta", "brunswick", "calhoun",
+	"carrollton", "cartersville", "chamblee", "colombus", "columbus", "dahlonega",
+	"griffin", "jeffersonville", "jenkinsburg", "lumber city", "macon", "marietta",
+	"monroe", "new hope", "rome", "savannah", "unadilla", "valdosta", "vidalia",
+}
+
+// georgiaCountry are the places in the country found in the crash data.
+var georgiaCountry = []string{
+	"batumi", "gudauta", "kobuleti", "kutaisi", "lata", "ochamchire", "poti",
+	"senaki", "sukhumi", "svanetia", "tbilisi", "tkvarcheli", "zugdidi",
+}
+
+// knownPlace reports whether the place contains one of the names.
+func knownPlace(place string, names []string) bool {
+	place = strings.ToLower(place)
+	for _, name := range names {
+		if strings.Contains(place, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// corrections fixes common misspellings found in the crash data.
+var corrections = map[string]string{
+	"minnisota":     "Minnesota",
+	"wisconson":     "Wisconsin",
+	"washingon":     "Washington",
+	"south dekota":  "South Dakota",
+	"calilfornia":   "California",
+	"massachusett":  "Massachusetts",
+	"phillipines":   "Philippines",
+	"philipines":    "Philippines",
+	"afghanstan":    "Afghanistan",
+	"kazakastan":    "Kazakhstan",
+	"kazakistan":    "Kazakhstan",
+	"uzbekstan":     "Uzbekistan",
+	"yugosalvia":    "Yugoslavia",
+	"nambia":        "Namibia",
+	"swden":         "Sweden",
+	"sierre leone":  "Sierra Leone",
+	"saudia arabia": "Saudi Arabia",
+	"w germany":     "West Germany",
+	"uk":            "United Kingdom",
+	"usa":           UnitedStates,
+	"u.s.a.":        UnitedStates,
+}
+
+// Location cleans up the raw crash location and splits it into place,
+// region and country.
+func Location(raw string) *model.LocationParts {
+	var parts []string
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.Trim(strings.Join(strings.Fields(p), " "), ".")
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	res := &model.LocationParts{}
+	if len(parts) == 0 {
+		return res
+	}
+
+	if q := qualifiers.FindString(parts[0]); q != "" {
+		res.Qualifier = strings.TrimSpace(q)
+		parts[0] = parts[0][len(q):]
+	}
+
+	for i, p := range parts {
+		parts[i] = correct(p)
+	}
+
+	last := parts[len(parts)-1]
+	state, abbreviated := states[strings.ToLower(strings.Replace(last, ".", "", -1))]
+	if abbreviated {
+		last = state
+	}
+
+	place := strings.Join(parts[:len(parts)-1], ", ")
+	georgia := !abbreviated && strings.EqualFold(last, Georgia) && !knownPlace(place, georgiaUS)
+
+	stateName, isState := stateNames[strings.ToLower(last)]
+	switch {
+	case georgia && knownPlace(place, georgiaCountry):
+		res.Country = Georgia
+		parts = parts[:len(parts)-1]
+	case georgia:
+		// ambiguous, the geocoder gets the place as it is
+	case isState:
+		res.Region = stateName
+		res.Country = UnitedStates
+		parts = parts[:len(parts)-1]
+	case len(parts) > 1:
+		res.Country = last
+		parts = parts[:len(parts)-1]
+		if len(parts) > 1 {
+			res.Region = parts[len(parts)-1]
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	res.Place = strings.Join(parts, ", ")
+
+	var normalized []string
+	for _, p := range []string{res.Place, res.Region, res.Country} {
+		if p != "" {
+			normalized = append(normalized, p)
+		}
+	}
+	res.Normalized = strings.Join(normalized, ", ")
+
+	return res
+}
+
+// correct fixes misspelling of the single location part.
+func correct(part string) string {
+	if c, ok := corrections[strings.ToLower(part)]; ok {
+		return c
+	}
+
+	return part
+}
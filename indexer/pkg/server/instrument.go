@@ -93,3 +93,14 @@ func (i *interceptor) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return hj.Hijack()
 }
+
+func (i *interceptor) Flush() {
+	if f, ok := i.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the parent ResponseWriter.
+func (i *interceptor) Unwrap() http.ResponseWriter {
+	return i.ResponseWriter
+}
@@ -88,20 +88,29 @@ func streamCrashes(conf *Config) chan model.FlightCrash {
 			}
 			f := model.FlightCrash{}
 
+			if line[2] != "?" {
+				f.Location = line[2]
+			}
+
 			var err error
 			date := line[0]
 			timeStr := line[1]
 			if timeStr == "" || timeStr == "?" {
 				timeStr = "00:00"
+				f.TimeUnknown = true
 			}
 
-			f.Date, err = time.Parse("January 02, 2006 15:04", date+" "+timeStr)
-			if err != nil {
-				log.Fatalf("Can't deserialize date and time of flight. Line: %d Date: %s, Flight: %s", i, date, timeStr)
+			// local time of the crash, UTC is used when the zone is unknown
+			loc := zone(f.Location)
+			if loc != nil {
+				f.TimeZone = loc.String()
+			} else {
+				loc = time.UTC
 			}
 
-			if line[2] != "?" {
-				f.Location = line[2]
+			f.Date, err = time.ParseInLocation("January 02, 2006 15:04", date+" "+timeStr, loc)
+			if err != nil {
+				log.Fatalf("Can't deserialize date and time of flight. Line: %d Date: %s, Flight: %s", i, date, timeStr)
 			}
 
 			if line[3] != "?" {
@@ -147,6 +156,8 @@ func streamCrashes(conf *Config) chan model.FlightCrash {
 				f.Summary = line[12]
 			}
 
+			f.ID = f.NaturalID()
+
 			out <- f
 		}
 
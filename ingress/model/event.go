@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Types of the flight crash changes.
+const (
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+// ChangeEvent is published when the indexed flight crash is edited or deleted.
+type ChangeEvent struct {
+	Type   string       `json:"type"`
+	ID     string       `json:"id"`
+	Flight *FlightCrash `json:"flight,omitempty"`
+	Time   time.Time    `json:"time"`
+}
@@ -1,24 +1,55 @@
 package model
 
-import "time"
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"time"
+)
 
-// FlightCrash holds info about the historical flight crash.
+// FlightCrash holds info about the historical flight crash. Date is the local
+// time of the crash with the offset of TimeZone, the IANA zone of the crash
+// site. When the zone is unknown the local time is stored as UTC. TimeUnknown
+// is set when only the day of the crash is known.
 type FlightCrash struct {
-	ID           string    `json:"id,omitempty"`
-	Date         time.Time `json:"date,omitempty"`
-	Location     string    `json:"location,omitempty"`
-	Operator     string    `json:"operator,omitempty"`
-	FlightNo     string    `json:"flightNo,omitempty"`
-	Route        string    `json:"route,omitempty"`
-	AircraftType string    `json:"aircraftType,omitempty"`
-	Registration string    `json:"registration,omitempty"`
-	SerialNumber string    `json:"serialNumber,omitempty"`
-	Aboard       Aboard    `json:"aboard,omitempty"`
-	Fatalities   Aboard    `json:"fatalities,omitempty"`
-	Ground       int       `json:"ground,omitempty"`
-	Summary      string    `json:"summary,omitempty"`
-	LocationGPS  *Location `json:"locationGPS,omitempty"`
-	Score        *float64  `json:"score,omitempty"`
+	ID            string         `json:"id,omitempty"`
+	Date          time.Time      `json:"date,omitempty"`
+	TimeUnknown   bool           `json:"timeUnknown,omitempty"`
+	TimeZone      string         `json:"timeZone,omitempty"`
+	Location      string         `json:"location,omitempty"`
+	LocationParts *LocationParts `json:"locationParts,omitempty"`
+	Operator      string         `json:"operator,omitempty"`
+	FlightNo      string         `json:"flightNo,omitempty"`
+	Route         string         `json:"route,omitempty"`
+	AircraftType  string         `json:"aircraftType,omitempty"`
+	Registration  string         `json:"registration,omitempty"`
+	SerialNumber  string         `json:"serialNumber,omitempty"`
+	Aboard        Aboard         `json:"aboard,omitempty"`
+	Fatalities    Aboard         `json:"fatalities,omitempty"`
+	Ground        int            `json:"ground,omitempty"`
+	Summary       string         `json:"summary,omitempty"`
+	LocationGPS   *Location      `json:"locationGPS,omitempty"`
+	Score         *float64       `json:"score,omitempty"`
+	Distance      *float64       `json:"distance,omitempty"`
+	// Highlight holds the summary fragments matching the search query.
+	Highlight map[string][]string `json:"highlight,omitempty"`
+}
+
+// NaturalID returns stable ID of the crash derived from its date,
+// registration, flight number, location and operator. The same crash always
+// gets the same ID, so re-ingesting data doesn't create duplicates. Date is
+// taken as the local wall clock, so the ID doesn't depend on the time zone.
+func (f *FlightCrash) NaturalID() string {
+	key := strings.Join([]string{
+		f.Date.Format("2006-01-02T15:04"),
+		f.Registration,
+		f.FlightNo,
+		f.Location,
+		f.Operator,
+	}, "|")
+
+	sum := sha1.Sum([]byte(strings.ToLower(key)))
+	return hex.EncodeToString(sum[:])
 }
 
 // Aboard holds information about the people on the plane.
@@ -28,6 +59,16 @@ type Aboard struct {
 	Passengers int `json:"passengers,omitempty"`
 }
 
+// LocationParts holds the crash location cleaned up and split into
+// structured parts. The original string stays in FlightCrash.Location.
+type LocationParts struct {
+	Normalized string `json:"normalized,omitempty"`
+	Qualifier  string `json:"qualifier,omitempty"`
+	Place      string `json:"place,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
 // Location holds inforamtion
 type Location struct {
 	Longitude float64 `json:"lon,omitempty"`
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mateuszdyminski/auto/indexer/pkg/normalize"
+)
+
+// countryZones maps the countries onto their IANA time zones. Only the
+// countries covered by a single time zone are listed, elsewhere the offset
+// can't be derived from the location alone.
+var countryZones = map[string]string{
+	"afghanistan":      "Asia/Kabul",
+	"algeria":          "Africa/Algiers",
+	"angola":           "Africa/Luanda",
+	"austria":          "Europe/Vienna",
+	"belgium":          "Europe/Brussels",
+	"bolivia":          "America/La_Paz",
+	"bulgaria":         "Europe/Sofia",
+	"china":            "Asia/Shanghai",
+	"colombia":         "America/Bogota",
+	"costa rica":       "America/Costa_Rica",
+	"cuba":             "America/Havana",
+	"czechoslovakia":   "Europe/Prague",
+	"denmark":          "Europe/Copenhagen",
+	"egypt":            "Africa/Cairo",
+	"england":          "Europe/London",
+	"ethiopia":         "Africa/Addis_Ababa",
+	"finland":          "Europe/Helsinki",
+	"france":           "Europe/Paris",
+	"georgia":          "Asia/Tbilisi",
+	"germany":          "Europe/Berlin",
+	"west germany":     "Europe/Berlin",
+	"east germany":     "Europe/Berlin",
+	"greece":           "Europe/Athens",
+	"guatemala":        "America/Guatemala",
+	"honduras":         "America/Tegucigalpa",
+	"hungary":          "Europe/Budapest",
+	"india":            "Asia/Kolkata",
+	"iran":             "Asia/Tehran",
+	"iraq":             "Asia/Baghdad",
+	"ireland":          "Europe/Dublin",
+	"israel":           "Asia/Jerusalem",
+	"italy":            "Europe/Rome",
+	"japan":            "Asia/Tokyo",
+	"kenya":            "Africa/Nairobi",
+	"laos":             "Asia/Vientiane",
+	"libya":            "Africa/Tripoli",
+	"morocco":          "Africa/Casablanca",
+	"nepal":            "Asia/Kathmandu",
+	"netherlands":      "Europe/Amsterdam",
+	"nicaragua":        "America/Managua",
+	"nigeria":          "Africa/Lagos",
+	"northern ireland": "Europe/London",
+	"norway":           "Europe/Oslo",
+	"pakistan":         "Asia/Karachi",
+	"panama":           "America/Panama",
+	"papua new guinea": "Pacific/Port_Moresby",
+	"peru":             "America/Lima",
+	"philippines":      "Asia/Manila",
+	"poland":           "Europe/Warsaw",
+	"puerto rico":      "America/Puerto_Rico",
+	"romania":          "Europe/Bucharest",
+	"saudi arabia":     "Asia/Riyadh",
+	"scotland":         "Europe/London",
+	"south africa":     "Africa/Johannesburg",
+	"south korea":      "Asia/Seoul",
+	"south vietnam":    "Asia/Ho_Chi_Minh",
+	"sudan":            "Africa/Khartoum",
+	"sweden":           "Europe/Stockholm",
+	"switzerland":      "Europe/Zurich",
+	"taiwan":           "Asia/Taipei",
+	"thailand":         "Asia/Bangkok",
+	"turkey":           "Europe/Istanbul",
+	"venezuela":        "America/Caracas",
+	"vietnam":          "Asia/Ho_Chi_Minh",
+	"wales":            "Europe/London",
+	"yugoslavia":       "Europe/Belgrade",
+}
+
+// stateZones maps the US states covered by a single time zone onto it.
+var stateZones = map[string]string{
+	"alabama":        "America/Chicago",
+	"arizona":        "America/Phoenix",
+	"arkansas":       "America/Chicago",
+	"california":     "America/Los_Angeles",
+	"colorado":       "America/Denver",
+	"connecticut":    "America/New_York",
+	"delaware":       "America/New_York",
+	"georgia":        "America/New_York",
+	"hawaii":         "Pacific/Honolulu",
+	"illinois":       "America/Chicago",
+	"iowa":           "America/Chicago",
+	"louisiana":      "America/Chicago",
+	"maine":          "America/New_York",
+	"maryland":       "America/New_York",
+	"massachusetts":  "America/New_York",
+	"minnesota":      "America/Chicago",
+	"mississippi":    "America/Chicago",
+	"missouri":       "America/Chicago",
+	"montana":        "America/Denver",
+	"nevada":         "America/Los_Angeles",
+	"new hampshire":  "America/New_York",
+	"new jersey":     "America/New_York",
+	"new mexico":     "America/Denver",
+	"new york":       "America/New_York",
+	"north carolina": "America/New_York",
+	"ohio":           "America/New_York",
+	"oklahoma":       "America/Chicago",
+	"pennsylvania":   "America/New_York",
+	"rhode island":   "America/New_York",
+	"south carolina": "America/New_York",
+	"utah":           "America/Denver",
+	"vermont":        "America/New_York",
+	"virginia":       "America/New_York",
+	"washington":     "America/Los_Angeles",
+	"west virginia":  "America/New_York",
+	"wisconsin":      "America/Chicago",
+	"wyoming":        "America/Denver",
+}
+
+// zone returns the time zone of the crash location, or nil when it can't be
+// derived. Location is normalized first, so the US states are told apart from
+// the countries of the same name.
+func zone(location string) *time.Location {
+	parts := normalize.Location(location)
+
+	var name string
+	var ok bool
+	if parts.Country == normalize.UnitedStates {
+		name, ok = stateZones[strings.ToLower(parts.Region)]
+	} else {
+		name, ok = countryZones[strings.ToLower(parts.Country)]
+	}
+	if !ok {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Warnf("Can't load time zone %s. Err: %v", name, err)
+		return nil
+	}
+
+	return loc
+}
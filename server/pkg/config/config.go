@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 
 	"github.com/BurntSushi/toml"
@@ -9,11 +10,18 @@ import (
 // Config holds configuration of feeder.
 type Config struct {
 	// NATS config
-	NATSAddress string
-	Topic       string
+	NATSAddress  string
+	Topic        string
+	ChangesTopic string
 
 	// Elastisearch config
 	Elastics []string
+	Index    string
+
+	// WebSocket config
+	ReplayBufferSize   int
+	StatsTickInterval  int
+	SlowConsumerPolicy string
 
 	// HTTP config
 	HTTPPort                int
@@ -33,5 +41,9 @@ func LoadConfig(pathToConfig string) (*Config, error) {
 		return nil, err
 	}
 
+	if conf.ReplayBufferSize < 0 {
+		return nil, fmt.Errorf("ReplayBufferSize can't be negative, got %d", conf.ReplayBufferSize)
+	}
+
 	return &conf, nil
 }
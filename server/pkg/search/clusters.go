@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+)
+
+// maxClusters limits the number of geohash buckets returned at once.
+const maxClusters = 10000
+
+// Cluster is a group of crashes located in the same geohash cell.
+type Cluster struct {
+	Geohash    string          `json:"geohash"`
+	Count      int64           `json:"count"`
+	Centroid   *model.Location `json:"centroid,omitempty"`
+	Fatalities int64           `json:"fatalities"`
+}
+
+// ClustersResponse holds clusters of crashes and the geohash precision used.
+type ClustersResponse struct {
+	Precision int       `json:"precision"`
+	Total     int64     `json:"total"`
+	Clusters  []Cluster `json:"clusters"`
+}
+
+// GeohashPrecision maps the zoom level of the web map onto the geohash
+// precision, so the cells are roughly of the size of the markers.
+func GeohashPrecision(zoom int) int {
+	switch {
+	case zoom <= 2:
+		return 1
+	case zoom <= 4:
+		return 2
+	case zoom <= 7:
+		return 3
+	case zoom <= 9:
+		return 4
+	case zoom <= 12:
+		return 5
+	case zoom <= 14:
+		return 6
+	case zoom <= 17:
+		return 7
+	default:
+		return 8
+	}
+}
+
+// Clusters groups crashes matching the request into geohash grid cells with
+// the precision derived from the map zoom level.
+func (s *FlightService) Clusters(req *Request, zoom int) (*ClustersResponse, error) {
+	query, err := s.finder(req).buildQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	precision := GeohashPrecision(zoom)
+	grid := elastic.NewGeoHashGridAggregation().
+		Field("locationGPS").
+		Precision(precision).
+		Size(maxClusters).
+		SubAggregation("centroid", elastic.NewGeoCentroidAggregation().Field("locationGPS")).
+		SubAggregation("fatalities", elastic.NewSumAggregation().Field("fatalities.total"))
+
+	res, err := s.esc.Search().
+		Index(s.cfg.Index).
+		Type("flight").
+		Query(query).
+		Size(0).
+		Aggregation("clusters", grid).
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ClustersResponse{Precision: precision, Clusters: make([]Cluster, 0)}
+	if res.Hits != nil {
+		response.Total = res.Hits.TotalHits
+	}
+
+	buckets, found := res.Aggregations.GeoHash("clusters")
+	if !found {
+		return response, nil
+	}
+
+	for _, b := range buckets.Buckets {
+		c := Cluster{Count: b.DocCount}
+		c.Geohash, _ = b.Key.(string)
+
+		if centroid, found := b.GeoCentroid("centroid"); found {
+			c.Centroid = &model.Location{Latitude: centroid.Location.Latitude, Longitude: centroid.Location.Longitude}
+		}
+
+		if sum, found := b.Sum("fatalities"); found && sum.Value != nil {
+			c.Fatalities = int64(*sum.Value)
+		}
+
+		response.Clusters = append(response.Clusters, c)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+)
+
+// maxResultWindow is the Elasticsearch limit of from + size in offset paging.
+const maxResultWindow = 10000
+
+// cursor points right after the last hit of the page. It holds the sort
+// values of the hit for search_after and the sort order they belong to.
+type cursor struct {
+	Sort   []string      `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// encodeCursor returns opaque cursor string.
+func encodeCursor(sort []string, values []interface{}) (string, error) {
+	data, err := json.Marshal(cursor{Sort: sort, Values: values})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns sort values stored in the cursor. The cursor has to be
+// created for the same sort order.
+func decodeCursor(s string, sort []string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &RequestError{Param: "cursor", Reason: "malformed cursor"}
+	}
+
+	var c cursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// keep long sort values, e.g. dates, intact
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil || len(c.Values) == 0 {
+		return nil, &RequestError{Param: "cursor", Reason: "malformed cursor"}
+	}
+
+	if len(c.Sort) != len(sort) || (len(sort) > 0 && !reflect.DeepEqual(c.Sort, sort)) {
+		return nil, &RequestError{Param: "cursor", Reason: "cursor was created for different sort order"}
+	}
+
+	return c.Values, nil
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// dateMath matches relative dates like now-10y or now/d.
+var dateMath = regexp.MustCompile(`^now([+-][0-9]+[yMwdhHms])*(/[yMwdhHms])?$`)
+
+// offset matches UTC offsets like +01:00.
+var offset = regexp.MustCompile(`^[+-][0-9]{2}:[0-9]{2}$`)
+
+// dateLayouts are the accepted absolute dates with the rounding which makes
+// the upper bound of the range include the whole period.
+var dateLayouts = []struct {
+	layout   string
+	rounding string
+}{
+	{time.RFC3339, ""},
+	{"2006-01-02T15:04:05", ""},
+	{"2006-01-02T15:04", ""},
+	{"2006-01-02", "||/d"},
+	{"2006-01", "||/M"},
+	{"2006", "||/y"},
+}
+
+// DateBound validates the bound of the date range and translates it into
+// Elasticsearch date math. Values without the offset are in the time zone of
+// the request. Date-only upper bounds include the whole day, month or year.
+func DateBound(param, value string, upper bool) (string, error) {
+	if dateMath.MatchString(value) {
+		return value, nil
+	}
+
+	for _, l := range dateLayouts {
+		if _, err := time.Parse(l.layout, value); err == nil {
+			if upper {
+				return value + l.rounding, nil
+			}
+			return value, nil
+		}
+	}
+
+	return "", &RequestError{Param: param, Reason: fmt.Sprintf("RFC3339 time, date or relative date like now-10y expected, got %q", value)}
+}
+
+// location returns the time zone validated with ValidTimeZone, UTC when it's empty.
+func location(tz string) *time.Location {
+	if offset.MatchString(tz) {
+		t, err := time.Parse("-07:00", tz)
+		if err == nil {
+			_, secs := t.Zone()
+			return time.FixedZone(tz, secs)
+		}
+	}
+
+	if loc, err := time.LoadLocation(tz); err == nil {
+		return loc
+	}
+
+	return time.UTC
+}
+
+// year returns the year of the date histogram bucket in the time zone.
+func year(key float64, loc *time.Location) int {
+	return time.Unix(0, int64(key)*int64(time.Millisecond)).In(loc).Year()
+}
+
+// ValidTimeZone checks whether tz is IANA time zone or UTC offset.
+func ValidTimeZone(tz string) error {
+	if offset.MatchString(tz) {
+		return nil
+	}
+
+	if _, err := time.LoadLocation(tz); err != nil || tz == "" || tz == "Local" {
+		return &RequestError{Param: "tz", Reason: fmt.Sprintf("IANA time zone or offset like +01:00 expected, got %q", tz)}
+	}
+
+	return nil
+}
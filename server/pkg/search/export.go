@@ -0,0 +1,51 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+)
+
+// exportPageSize is the number of crashes fetched with a single scroll request.
+const exportPageSize = 500
+
+// Export streams all crashes matching the request, oldest first, to fn using
+// the scroll API, so the results are never buffered in memory as a whole.
+// Export stops at the first error returned by fn.
+func (s *FlightService) Export(ctx context.Context, req *Request, fn func(*model.FlightCrash) error) error {
+	query, err := s.finder(req).buildQuery()
+	if err != nil {
+		return err
+	}
+
+	scroll := s.esc.Scroll(s.cfg.Index).
+		Type("flight").
+		Query(query).
+		Sort("date", true).
+		Size(exportPageSize)
+	defer scroll.Clear(context.Background())
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range res.Hits.Hits {
+			var flight model.FlightCrash
+			if err := json.Unmarshal(*hit.Source, &flight); err != nil {
+				return err
+			}
+			flight.ID = hit.Id
+
+			if err := fn(&flight); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/olivere/elastic"
+)
+
+// defaultFacetSize is the number of facet values returned when size is not set.
+const defaultFacetSize = 10
+
+// facetFields maps the fields permitted as facets onto the fields in the
+// index. Decade facet is computed from the date.
+var facetFields = map[string]string{
+	"operator":     "operator.keyword",
+	"aircraftType": "aircraftType.keyword",
+	"country":      "locationParts.country",
+	"decade":       "date",
+}
+
+// Facet requests counts of the most common values of the field.
+type Facet struct {
+	Field string
+	Size  int
+}
+
+// FacetBucket holds the facet value and the number of matching crashes.
+// The value can be passed as filter of the same name in the next request.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// aggregation returns the aggregation computing the facet. Decades are
+// computed in the time zone tz.
+func (f Facet) aggregation(tz string) (elastic.Aggregation, error) {
+	field, ok := facetFields[f.Field]
+	if !ok {
+		return nil, &RequestError{Param: "facets", Reason: fmt.Sprintf("facet %s is not supported", f.Field)}
+	}
+
+	if f.Field == "decade" {
+		agg := elastic.NewDateHistogramAggregation().Field(field).Interval("year").MinDocCount(1)
+		if tz != "" {
+			agg = agg.TimeZone(tz)
+		}
+		return agg, nil
+	}
+
+	size := f.Size
+	if size <= 0 {
+		size = defaultFacetSize
+	}
+
+	return elastic.NewTermsAggregation().Field(field).Size(size), nil
+}
+
+// buckets reads the facet values from the search result.
+func (f Facet) buckets(aggs elastic.Aggregations, tz string) []FacetBucket {
+	res := make([]FacetBucket, 0)
+	name := "facet_" + f.Field
+
+	if f.Field != "decade" {
+		terms, found := aggs.Terms(name)
+		if !found {
+			return res
+		}
+
+		for _, b := range terms.Buckets {
+			res = append(res, FacetBucket{Value: fmt.Sprint(b.Key), Count: b.DocCount})
+		}
+		return res
+	}
+
+	histogram, found := aggs.DateHistogram(name)
+	if !found {
+		return res
+	}
+
+	// fold the years into decades, years come sorted
+	loc := location(tz)
+	for _, b := range histogram.Buckets {
+		decade := strconv.Itoa(year(b.Key, loc) / 10 * 10)
+		if n := len(res); n == 0 || res[n-1].Value != decade {
+			res = append(res, FacetBucket{Value: decade})
+		}
+		res[len(res)-1].Count += b.DocCount
+	}
+
+	// the most common decades first, like the terms facets
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Count > res[j].Count
+	})
+
+	if f.Size > 0 && len(res) > f.Size {
+		res = res[:f.Size]
+	}
+
+	return res
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic"
+)
+
+// termFields maps the fields permitted in term filters onto the fields in the index.
+var termFields = map[string]string{
+	"operator":     "operator.keyword",
+	"aircraftType": "aircraftType.keyword",
+	"registration": "registration",
+	"flightNo":     "flightNo",
+	"route":        "route.keyword",
+	"country":      "locationParts.country",
+}
+
+// rangeFields maps the fields permitted in range filters onto the fields in the index.
+var rangeFields = map[string]string{
+	"fatalities": "fatalities.total",
+	"aboard":     "aboard.total",
+	"ground":     "ground",
+}
+
+// TermFields returns names of the fields permitted in term filters.
+func TermFields() []string {
+	return keys(termFields)
+}
+
+// RangeFields returns names of the fields permitted in range filters.
+func RangeFields() []string {
+	return keys(rangeFields)
+}
+
+// Filter narrows down the results with structured conditions. Conditions are
+// combined with AND, or with OR when Any is set. Negated conditions always
+// exclude the matching crashes. Decades match the crashes which happened in
+// any of them, e.g. 1970 stands for 1970-1979.
+type Filter struct {
+	Any     bool
+	Terms   []TermFilter
+	Ranges  []RangeFilter
+	Decades []int
+
+	// TimeZone of the decade boundaries, the same as of the decade facet.
+	TimeZone string
+}
+
+// TermFilter matches crashes whose field is equal to one of the values.
+// Values containing '*' or '?' are matched as wildcards, e.g. "Tupolev*".
+type TermFilter struct {
+	Field  string
+	Values []string
+	Not    bool
+}
+
+// RangeFilter matches crashes whose field is between Min and Max, inclusive.
+type RangeFilter struct {
+	Field string
+	Min   *int
+	Max   *int
+}
+
+// Empty reports whether filter has no conditions.
+func (f *Filter) Empty() bool {
+	return f == nil || (len(f.Terms) == 0 && len(f.Ranges) == 0 && len(f.Decades) == 0)
+}
+
+// Query translates the filter into Elasticsearch query.
+func (f *Filter) Query() (elastic.Query, error) {
+	q := elastic.NewBoolQuery()
+
+	var clauses []elastic.Query
+	for _, t := range f.Terms {
+		field, ok := termFields[t.Field]
+		if !ok {
+			return nil, &RequestError{Param: t.Field, Reason: "filtering by this field is not supported"}
+		}
+
+		var values []elastic.Query
+		for _, v := range t.Values {
+			if strings.ContainsAny(v, "*?") {
+				values = append(values, elastic.NewWildcardQuery(field, v))
+			} else {
+				values = append(values, elastic.NewTermQuery(field, v))
+			}
+		}
+
+		clause := elastic.NewBoolQuery().Should(values...).MinimumNumberShouldMatch(1)
+		if t.Not {
+			q = q.MustNot(clause)
+		} else {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	for _, r := range f.Ranges {
+		field, ok := rangeFields[r.Field]
+		if !ok {
+			return nil, &RequestError{Param: r.Field, Reason: "filtering by this field is not supported"}
+		}
+
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return nil, &RequestError{Param: r.Field, Reason: fmt.Sprintf("min %d is greater than max %d", *r.Min, *r.Max)}
+		}
+
+		rq := elastic.NewRangeQuery(field)
+		if r.Min != nil {
+			rq = rq.Gte(*r.Min)
+		}
+		if r.Max != nil {
+			rq = rq.Lte(*r.Max)
+		}
+		clauses = append(clauses, rq)
+	}
+
+	if len(f.Decades) > 0 {
+		var decades []elastic.Query
+		for _, d := range f.Decades {
+			rq := elastic.NewRangeQuery("date").
+				Gte(fmt.Sprintf("%04d-01-01", d)).
+				Lt(fmt.Sprintf("%04d-01-01", d+10)).
+				Format("yyyy-MM-dd")
+			if f.TimeZone != "" {
+				rq = rq.TimeZone(f.TimeZone)
+			}
+			decades = append(decades, rq)
+		}
+		clauses = append(clauses, elastic.NewBoolQuery().Should(decades...).MinimumNumberShouldMatch(1))
+	}
+
+	if f.Any && len(clauses) > 0 {
+		q = q.Filter(elastic.NewBoolQuery().Should(clauses...).MinimumNumberShouldMatch(1))
+	} else {
+		q = q.Filter(clauses...)
+	}
+
+	return q, nil
+}
@@ -3,48 +3,109 @@ package search
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"strings"
-	"time"
 
 	"github.com/mateuszdyminski/auto/ingress/model"
 	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
 )
 
+// queryFields are the fields searched by full-text query with their boosts.
+var queryFields = map[string]float64{
+	"operator":     3,
+	"aircraftType": 2,
+	"location":     2,
+	"route":        1,
+	"summary":      1,
+}
+
+// sortFields maps the permitted sort fields onto the fields in the index.
+var sortFields = map[string]string{
+	"_score":       "_score",
+	"date":         "date",
+	"operator":     "operator.keyword",
+	"aircraftType": "aircraftType.keyword",
+	"location":     "location.keyword",
+	"aboard":       "aboard.total",
+	"fatalities":   "fatalities.total",
+	"ground":       "ground",
+}
+
 type Finder struct {
+	index       string
 	queryString string
-	from        time.Time
-	to          time.Time
+	from        string
+	to          string
+	timeZone    string
+	filter      *Filter
+	geo         *GeoFilter
+	facets      []Facet
 	skip        int
 	size        int
+	cursor      string
 	sort        []string
+	highlight   bool
 }
 
-// NewFinder creates a new finder for logs.
+// NewFinder creates a new finder for flight crashes.
 // Use the funcs to set up filters and search properties,
 // then call Find to execute.
 func NewFinder() *Finder {
-	return &Finder{}
+	return &Finder{index: "flights"}
 }
 
-// Query searches the results by the given string query.
+// Index sets the index or alias to search in.
+func (f *Finder) Index(index string) *Finder {
+	f.index = index
+	return f
+}
+
+// Query searches the results by the given string query in summary, operator,
+// location, aircraft type and route.
 func (f *Finder) Query(queryString string) *Finder {
 	f.queryString = queryString
 	return f
 }
 
 // From filters the results which occur after specified time.
-func (f *Finder) From(from time.Time) *Finder {
+// It accepts Elasticsearch dates and date math, see DateBound.
+func (f *Finder) From(from string) *Finder {
 	f.from = from
 	return f
 }
 
 // To filters the results which occur before specified time.
-func (f *Finder) To(to time.Time) *Finder {
+// It accepts Elasticsearch dates and date math, see DateBound.
+func (f *Finder) To(to string) *Finder {
 	f.to = to
 	return f
 }
 
+// TimeZone sets the time zone of the From and To dates without offset.
+func (f *Finder) TimeZone(tz string) *Finder {
+	f.timeZone = tz
+	return f
+}
+
+// Filter narrows down the results with structured conditions.
+func (f *Finder) Filter(filter *Filter) *Finder {
+	f.filter = filter
+	return f
+}
+
+// Geo narrows down the results to the crashes located in the area.
+func (f *Finder) Geo(geo *GeoFilter) *Finder {
+	f.geo = geo
+	return f
+}
+
+// Facets requests counts of the most common values of the fields next to the results.
+func (f *Finder) Facets(facets ...Facet) *Finder {
+	f.facets = append(f.facets, facets...)
+	return f
+}
+
 // Skip specifies the number of items to skip in pagination.
 func (f *Finder) Skip(skip int) *Finder {
 	f.skip = skip
@@ -57,9 +118,18 @@ func (f *Finder) Size(size int) *Finder {
 	return f
 }
 
+// After continues the search after the last hit of the previous page.
+// Use the cursor returned in the Response. Deep pages should be fetched with
+// cursor as offset paging is limited to the first 10000 hits.
+func (f *Finder) After(cursor string) *Finder {
+	f.cursor = cursor
+	return f
+}
+
 // Sort specifies one or more sort orders.
 // Use a dash (-) to make the sort order descending.
-// Example: "name" or "-year".
+// Example: "date" or "-fatalities". Only the fields from sortFields are permitted,
+// plus "distance" which sorts by the distance from the center of the Geo filter.
 func (f *Finder) Sort(sort ...string) *Finder {
 	if f.sort == nil {
 		f.sort = make([]string, 0)
@@ -68,45 +138,97 @@ func (f *Finder) Sort(sort ...string) *Finder {
 	return f
 }
 
+// Highlight returns the fragments of the summary matching the query with
+// the matches wrapped in <em> tags.
+func (f *Finder) Highlight(highlight bool) *Finder {
+	f.highlight = highlight
+	return f
+}
+
 // query sets up the query in the search service.
-func (f *Finder) query(service *elastic.SearchService) *elastic.SearchService {
-	if f.queryString == "" && f.from.IsZero() && f.to.IsZero() {
-		service = service.Query(elastic.NewMatchAllQuery())
-		return service
+func (f *Finder) query(service *elastic.SearchService) (*elastic.SearchService, error) {
+	q, err := f.buildQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Query(q), nil
+}
+
+// buildQuery translates full-text query, date range and filters into
+// Elasticsearch query.
+func (f *Finder) buildQuery() (elastic.Query, error) {
+	if f.queryString == "" && f.from == "" && f.to == "" && f.filter.Empty() && f.geo.Empty() {
+		return elastic.NewMatchAllQuery(), nil
 	}
 
 	q := elastic.NewBoolQuery()
 	if f.queryString != "" {
-		q = q.Must(elastic.NewQueryStringQuery(f.queryString).Field("msg"))
+		mq := elastic.NewMultiMatchQuery(f.queryString)
+		for field, boost := range queryFields {
+			mq = mq.FieldWithBoost(field, boost)
+		}
+		q = q.Must(mq)
+	}
+	if f.from != "" || f.to != "" {
+		rq := elastic.NewRangeQuery("date")
+		if f.from != "" {
+			rq = rq.Gte(f.from)
+		}
+		if f.to != "" {
+			rq = rq.Lte(f.to)
+		}
+		if f.timeZone != "" {
+			rq = rq.TimeZone(f.timeZone)
+		}
+		q = q.Filter(rq)
 	}
-	if !f.from.IsZero() {
-		q = q.Must(elastic.NewRangeQuery("time").Gte(f.from))
+	if !f.filter.Empty() {
+		fq, err := f.filter.Query()
+		if err != nil {
+			return nil, err
+		}
+		q = q.Filter(fq)
 	}
-	if !f.to.IsZero() {
-		q = q.Must(elastic.NewRangeQuery("time").Lte(f.to))
+	if !f.geo.Empty() {
+		q = q.Filter(f.geo.Query())
 	}
 
-	service = service.Query(q)
-	return service
+	return q, nil
 }
 
 // paginate sets up pagination in the service.
-func (f *Finder) paginate(service *elastic.SearchService) *elastic.SearchService {
+func (f *Finder) paginate(service *elastic.SearchService) (*elastic.SearchService, error) {
+	if f.cursor != "" {
+		if f.skip > 0 {
+			return nil, &RequestError{Param: "s", Reason: "offset can't be used together with cursor"}
+		}
+
+		values, err := decodeCursor(f.cursor, f.sort)
+		if err != nil {
+			return nil, err
+		}
+		service = service.SearchAfter(values...)
+	}
+
+	if f.skip+f.size > maxResultWindow {
+		return nil, &RequestError{Param: "s", Reason: fmt.Sprintf("offset paging is limited to %d hits, use cursor", maxResultWindow)}
+	}
+
 	if f.skip > 0 {
 		service = service.From(f.skip)
 	}
 	if f.size > 0 {
 		service = service.Size(f.size)
 	}
-	return service
+	return service, nil
 }
 
 // sorting applies sorting to the service.
-func (f *Finder) sorting(service *elastic.SearchService) *elastic.SearchService {
+func (f *Finder) sorting(service *elastic.SearchService) (*elastic.SearchService, error) {
 	if len(f.sort) == 0 {
 		// Sort by score by default
-		service = service.Sort("_score", false)
-		return service
+		return service.Sort("_score", false).Sort("_id", true), nil
 	}
 
 	// Sort by fields; prefix of "-" means: descending sort order.
@@ -124,19 +246,62 @@ func (f *Finder) sorting(service *elastic.SearchService) *elastic.SearchService
 			asc = true
 		}
 
-		// Maybe check for permitted fields to sort
+		if field == "distance" {
+			if f.geo == nil || f.geo.Near == nil {
+				return nil, &RequestError{Param: "sort", Reason: "sorting by distance requires near parameter"}
+			}
+
+			service = service.SortBy(elastic.NewGeoDistanceSort("locationGPS").
+				Point(f.geo.Near.Latitude, f.geo.Near.Longitude).
+				Unit("km").
+				Order(asc))
+			continue
+		}
+
+		indexField, ok := sortFields[field]
+		if !ok {
+			return nil, &RequestError{Param: "sort", Reason: fmt.Sprintf("can't sort by field %s", field)}
+		}
 
-		service = service.Sort(field, asc)
+		service = service.Sort(indexField, asc)
 	}
-	return service
+
+	// document ID breaks the ties, so the cursor always points to a single hit.
+	// It's _id, as the id field is missing in the documents indexed before it.
+	return service.Sort("_id", true), nil
 }
 
 func (f *Finder) Find(client *elastic.Client) (*Response, error) {
 	// Create service and use query, aggregations, sort, filter, pagination funcs
-	search := client.Search().Index("flights").Type("flight")
-	search = f.query(search)
-	search = f.sorting(search)
-	search = f.paginate(search)
+	search, err := f.query(client.Search().Index(f.index).Type("flight"))
+	if err != nil {
+		return nil, err
+	}
+	search, err = f.sorting(search)
+	if err != nil {
+		return nil, err
+	}
+	search, err = f.paginate(search)
+	if err != nil {
+		return nil, err
+	}
+	for _, facet := range f.facets {
+		agg, err := facet.aggregation(f.timeZone)
+		if err != nil {
+			return nil, err
+		}
+		search = search.Aggregation("facet_"+facet.Field, agg)
+	}
+	if f.highlight {
+		search = search.Highlight(elastic.NewHighlight().
+			Field("summary").
+			FragmentSize(150).
+			NumOfFragments(3).
+			PreTags("<em>").
+			PostTags("</em>").
+			// summary text is escaped, so only the tags are markup
+			Encoder("html"))
+	}
 
 	// Execute query
 	searchResult, err := search.Do(context.Background())
@@ -145,30 +310,53 @@ func (f *Finder) Find(client *elastic.Client) (*Response, error) {
 	}
 
 	response := Response{}
-	logs := make([]model.FlightCrash, 0)
+	flights := make([]model.FlightCrash, 0)
 	// Here's how you iterate through results with full control over each step.
 	if searchResult.Hits != nil {
-		log.Printf("for (query: %s, from: %v, to: %v, size: %d, skip: %d) found a total of %d logs\n", f.queryString, f.from, f.to, f.size, f.skip, searchResult.Hits.TotalHits)
+		log.Debug().Msgf("for (query: %s, from: %v, to: %v, size: %d, skip: %d) found a total of %d flights", f.queryString, f.from, f.to, f.size, f.skip, searchResult.Hits.TotalHits)
 
 		response.Total = searchResult.Hits.TotalHits
 
 		// Iterate through results
 		for _, hit := range searchResult.Hits.Hits {
-			var l model.FlightCrash
-			err := json.Unmarshal(*hit.Source, &l)
+			var flight model.FlightCrash
+			err := json.Unmarshal(*hit.Source, &flight)
 			if err != nil {
 				return nil, err
 			}
 
 			if hit.Score != nil {
-				l.Score = hit.Score
+				flight.Score = hit.Score
+			}
+
+			if f.geo != nil && f.geo.Near != nil && flight.LocationGPS != nil {
+				distance := distanceKm(f.geo.Near, flight.LocationGPS)
+				flight.Distance = &distance
+			}
+
+			if len(hit.Highlight) > 0 {
+				flight.Highlight = hit.Highlight
 			}
 
-			l.ID = hit.Id
-			logs = append(logs, l)
+			flight.ID = hit.Id
+			flights = append(flights, flight)
+		}
+	}
+	response.Data = flights
+
+	// full page means there might be more hits
+	if hits := searchResult.Hits; hits != nil && f.size > 0 && len(hits.Hits) == f.size {
+		if response.Cursor, err = encodeCursor(f.sort, hits.Hits[len(hits.Hits)-1].Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.facets) > 0 {
+		response.Facets = make(map[string][]FacetBucket)
+		for _, facet := range f.facets {
+			response.Facets[facet.Field] = facet.buckets(searchResult.Aggregations, f.timeZone)
 		}
 	}
-	response.Data = logs
 
 	return &response, nil
 }
@@ -0,0 +1,249 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrNotFound is returned when there is no flight crash with given ID.
+	ErrNotFound = errors.New("flight crash not found")
+
+	// ErrConflict is returned when the flight crash was modified since it was read.
+	ErrConflict = errors.New("flight crash was modified in the meantime")
+)
+
+// Version identifies the revision of the flight crash document. It's used for
+// optimistic concurrency control of the writes.
+type Version struct {
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// String formats version as "seqNo.primaryTerm".
+func (v *Version) String() string {
+	return fmt.Sprintf("%d.%d", v.SeqNo, v.PrimaryTerm)
+}
+
+// ParseVersion parses version formatted with Version.String.
+func ParseVersion(s string) (*Version, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return nil, &RequestError{Param: "version", Reason: fmt.Sprintf("malformed version %q", s)}
+	}
+
+	seqNo, err1 := strconv.ParseInt(parts[0], 10, 64)
+	term, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, &RequestError{Param: "version", Reason: fmt.Sprintf("malformed version %q", s)}
+	}
+
+	return &Version{SeqNo: seqNo, PrimaryTerm: term}, nil
+}
+
+// Get returns the flight crash with its current version. Realtime get returns
+// the seq_no and primary_term of the document together with its source, a
+// document without them can't be written conditionally, so it's an error.
+func (s *FlightService) Get(ctx context.Context, id string) (*model.FlightCrash, *Version, error) {
+	res, err := s.esc.Get().
+		Index(s.cfg.Index).
+		Type("flight").
+		Id(id).
+		Realtime(true).
+		FetchSource(true).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !res.Found || res.Source == nil {
+		return nil, nil, ErrNotFound
+	}
+
+	var flight model.FlightCrash
+	if err := json.Unmarshal(*res.Source, &flight); err != nil {
+		return nil, nil, err
+	}
+	flight.ID = res.Id
+
+	if res.SeqNo == nil || res.PrimaryTerm == nil {
+		return nil, nil, fmt.Errorf("no seq_no and primary_term returned for flight crash %s", id)
+	}
+
+	return &flight, &Version{SeqNo: *res.SeqNo, PrimaryTerm: *res.PrimaryTerm}, nil
+}
+
+// Replace stores the flight crash under the ID if it's still in the version.
+func (s *FlightService) Replace(ctx context.Context, id string, flight *model.FlightCrash, version *Version) (*Version, error) {
+	if flight.ID != "" && flight.ID != id {
+		return nil, &RequestError{Param: "id", Reason: "ID in the body doesn't match the ID in the path"}
+	}
+
+	if err := validateFlight(flight); err != nil {
+		return nil, err
+	}
+
+	flight.ID = id
+	// score, distance and highlight only describe the search hit
+	flight.Score = nil
+	flight.Distance = nil
+	flight.Highlight = nil
+
+	res, err := s.esc.Index().
+		Index(s.cfg.Index).
+		Type("flight").
+		Id(id).
+		IfSeqNo(version.SeqNo).
+		IfPrimaryTerm(version.PrimaryTerm).
+		BodyJson(flight).
+		Refresh("wait_for").
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishChange(model.Updated, id, flight)
+
+	return &Version{SeqNo: res.SeqNo, PrimaryTerm: res.PrimaryTerm}, nil
+}
+
+// Patch applies JSON merge patch (RFC 7386) to the flight crash. When version
+// is nil the current version is patched.
+func (s *FlightService) Patch(ctx context.Context, id string, patch json.RawMessage, version *Version) (*model.FlightCrash, *Version, error) {
+	flight, current, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if version != nil && *version != *current {
+		return nil, nil, ErrConflict
+	}
+
+	doc, err := json.Marshal(flight)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var target, changes interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, nil, &RequestError{Param: "body", Reason: fmt.Sprintf("can't decode patch: %v", err)}
+	}
+
+	if doc, err = json.Marshal(mergePatch(target, changes)); err != nil {
+		return nil, nil, err
+	}
+
+	var patched model.FlightCrash
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		return nil, nil, &RequestError{Param: "body", Reason: fmt.Sprintf("patched flight crash is malformed: %v", err)}
+	}
+
+	newVersion, err := s.Replace(ctx, id, &patched, current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &patched, newVersion, nil
+}
+
+// Delete removes the flight crash if it's still in the version.
+func (s *FlightService) Delete(ctx context.Context, id string, version *Version) error {
+	_, err := s.esc.Delete().
+		Index(s.cfg.Index).
+		Type("flight").
+		Id(id).
+		IfSeqNo(version.SeqNo).
+		IfPrimaryTerm(version.PrimaryTerm).
+		Refresh("wait_for").
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if elastic.IsConflict(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	s.publishChange(model.Deleted, id, nil)
+	return nil
+}
+
+// publishChange lets other services and WebSocket clients know about the edit.
+func (s *FlightService) publishChange(typ, id string, flight *model.FlightCrash) {
+	data, err := json.Marshal(model.ChangeEvent{Type: typ, ID: id, Flight: flight, Time: time.Now()})
+	if err != nil {
+		log.Error().Msgf("can't marshal change event. err: %v", err)
+		return
+	}
+
+	if err := s.nc.Publish(s.cfg.ChangesTopic, data); err != nil {
+		log.Error().Msgf("can't publish change event to topic: %s. err: %v", s.cfg.ChangesTopic, err)
+	}
+}
+
+// mergePatch applies JSON merge patch to the target decoded into interface{}.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// validateFlight checks whether the flight crash can be stored.
+func validateFlight(f *model.FlightCrash) error {
+	switch {
+	case f.Date.IsZero():
+		return &RequestError{Param: "date", Reason: "date is required"}
+	case strings.TrimSpace(f.Location) == "":
+		return &RequestError{Param: "location", Reason: "location is required"}
+	case f.Ground < 0:
+		return &RequestError{Param: "ground", Reason: "can't be negative"}
+	case f.Aboard.Total < 0 || f.Aboard.Crew < 0 || f.Aboard.Passengers < 0:
+		return &RequestError{Param: "aboard", Reason: "can't be negative"}
+	case f.Fatalities.Total < 0 || f.Fatalities.Crew < 0 || f.Fatalities.Passengers < 0:
+		return &RequestError{Param: "fatalities", Reason: "can't be negative"}
+	}
+
+	if gps := f.LocationGPS; gps != nil {
+		if gps.Latitude < -90 || gps.Latitude > 90 || gps.Longitude < -180 || gps.Longitude > 180 {
+			return &RequestError{Param: "locationGPS", Reason: "coordinates out of range"}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"math"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+)
+
+const earthRadiusKm = 6371.0
+
+// GeoFilter narrows down the results to the crashes located in the area.
+// All set areas have to match.
+type GeoFilter struct {
+	// BBox is the bounding box of the area, e.g. map viewport.
+	BBox *BoundingBox
+	// Near is the center of the circle with Radius, e.g. "50km".
+	Near   *model.Location
+	Radius string
+	// Polygon holds the vertices of the area.
+	Polygon []model.Location
+}
+
+// BoundingBox is the rectangle limited by two meridians and two parallels.
+type BoundingBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// Empty reports whether no area is set.
+func (g *GeoFilter) Empty() bool {
+	return g == nil || (g.BBox == nil && g.Near == nil && len(g.Polygon) == 0)
+}
+
+// Query translates the filter into Elasticsearch geo queries on locationGPS.
+func (g *GeoFilter) Query() elastic.Query {
+	q := elastic.NewBoolQuery()
+
+	if g.BBox != nil {
+		q = q.Filter(elastic.NewGeoBoundingBoxQuery("locationGPS").
+			TopLeft(g.BBox.North, g.BBox.West).
+			BottomRight(g.BBox.South, g.BBox.East))
+	}
+
+	if g.Near != nil {
+		q = q.Filter(elastic.NewGeoDistanceQuery("locationGPS").
+			Lat(g.Near.Latitude).
+			Lon(g.Near.Longitude).
+			Distance(g.Radius))
+	}
+
+	if len(g.Polygon) > 0 {
+		pq := elastic.NewGeoPolygonQuery("locationGPS")
+		for _, p := range g.Polygon {
+			pq = pq.AddPoint(p.Latitude, p.Longitude)
+		}
+		q = q.Filter(pq)
+	}
+
+	return q
+}
+
+// distanceKm returns great-circle distance between two points.
+func distanceKm(a, b *model.Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
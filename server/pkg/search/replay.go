@@ -0,0 +1,115 @@
+package search
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mateuszdyminski/auto/server/pkg/ws"
+	"github.com/rs/zerolog/log"
+)
+
+// recent is a bounded ring buffer of the events sent to the WebSocket
+// clients, used to replay the feed to the clients which connect late.
+type recent struct {
+	events []*ws.Event
+	start  int
+}
+
+func newRecent(size int) *recent {
+	return &recent{events: make([]*ws.Event, 0, size)}
+}
+
+func (r *recent) add(e *ws.Event) {
+	if cap(r.events) == 0 {
+		return
+	}
+
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, e)
+		return
+	}
+
+	r.events[r.start] = e
+	r.start = (r.start + 1) % len(r.events)
+}
+
+// at returns i-th oldest event.
+func (r *recent) at(i int) *ws.Event {
+	return r.events[(r.start+i)%len(r.events)]
+}
+
+// after returns the events published after the point. The point is the ID
+// of the last event or the ID of the last crash seen by the client, or the
+// time. The whole buffer is returned and truncated is set when the point is
+// older than the buffer. Event IDs of the previous boots are never found, so
+// they are truncated as well.
+func (r *recent) after(since time.Time, lastID string) (events []*ws.Event, truncated bool) {
+	from := 0
+	switch {
+	case lastID != "":
+		for i := len(r.events) - 1; i >= 0; i-- {
+			e := r.at(i)
+			if e.ID == lastID || (e.Flight() != nil && e.Flight().ID == lastID) {
+				from = i + 1
+				break
+			}
+		}
+		truncated = from == 0
+	case !since.IsZero():
+		from = len(r.events)
+		for from > 0 && r.at(from-1).Time.After(since) {
+			from--
+		}
+		truncated = from == 0 && len(r.events) == cap(r.events)
+	default:
+		return nil, false
+	}
+
+	events = make([]*ws.Event, 0, len(r.events)-from)
+	for i := from; i < len(r.events); i++ {
+		events = append(events, r.at(i))
+	}
+	return events, truncated
+}
+
+// broadcast sends the event to the WebSocket clients and remembers it for
+// replay. Stats ticks are outdated by the next one, so they are neither
+// numbered nor replayed.
+func (s *FlightService) broadcast(typ string, payload interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &ws.Event{Type: typ, Time: time.Now(), Payload: payload}
+	if typ != ws.StatsTick {
+		s.seq++
+		e.Seq = s.seq
+		e.ID = fmt.Sprintf("%s-%d", s.boot, s.seq)
+		s.recent.add(e)
+	}
+	s.Ws.Broadcast <- e
+}
+
+// Connect registers the WebSocket connection in the hub. Events published
+// after since, or after the event with lastID, are replayed to the connection
+// before the live feed. Registration and broadcast exclude each other, so no
+// event is missed nor sent twice.
+func (s *FlightService) Connect(c *ws.Connection, since time.Time, lastID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replay, truncated := s.recent.after(since, lastID)
+	if truncated {
+		replay = append([]*ws.Event{{
+			Type:    ws.ServerNotice,
+			Time:    time.Now(),
+			Payload: &ws.Notice{Level: "warn", Message: "some events were missed, replaying the oldest kept ones"},
+		}}, replay...)
+	}
+
+	c.Replay = replay
+	if len(c.Replay) > 0 {
+		log.Info().Msgf("Replaying %d events to WS client", len(c.Replay))
+	}
+
+	s.Ws.Register <- c
+}
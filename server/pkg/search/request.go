@@ -0,0 +1,52 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Request holds parameters of the flights search.
+type Request struct {
+	Query string
+	// From and To are RFC3339 times, dates or relative dates like now-10y.
+	From string
+	To   string
+	// TimeZone applies to the dates without offset and to rounding of the
+	// relative dates.
+	TimeZone string
+	Filter   *Filter
+	Geo      *GeoFilter
+	Facets   []Facet
+	Sort     []string
+	Size     int
+	Skip     int
+	// Cursor continues the search after the last hit of the previous page.
+	Cursor string
+	// Highlight returns the summary fragments matching the query.
+	Highlight bool
+}
+
+// RequestError is returned when the search request is malformed.
+type RequestError struct {
+	Param  string
+	Reason string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("wrong parameter %s: %s", e.Param, e.Reason)
+}
+
+// IsRequestError reports whether err was caused by malformed request.
+func IsRequestError(err error) bool {
+	_, ok := err.(*RequestError)
+	return ok
+}
+
+func keys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
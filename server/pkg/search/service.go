@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,6 +21,12 @@ type FlightService struct {
 	esc *elastic.Client
 	nc  *nats.Conn
 	Ws  *ws.Hub
+
+	// guards replay buffer, event numbering and broadcasting to the hub
+	mu     sync.Mutex
+	boot   string
+	seq    uint64
+	recent *recent
 }
 
 func NewFlightService(cfg *config.Config, ctx context.Context) (*FlightService, error) {
@@ -36,10 +43,16 @@ func NewFlightService(cfg *config.Config, ctx context.Context) (*FlightService,
 	}
 
 	// turn on the WebSockets server
-	ws := ws.NewHub()
+	ws, err := ws.NewHub(cfg.SlowConsumerPolicy)
+	if err != nil {
+		return nil, err
+	}
 	go ws.Run()
 
-	fs := &FlightService{cfg: cfg, esc: esc, Ws: ws, nc: nc}
+	// seq starts over with every boot, so event IDs carry the boot ID
+	boot := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	fs := &FlightService{cfg: cfg, esc: esc, Ws: ws, nc: nc, boot: boot, recent: newRecent(cfg.ReplayBufferSize)}
 	go func() {
 		if err := fs.Run(ctx); err != nil {
 			log.Error().Msgf("error during collecting flight crashes")
@@ -70,7 +83,7 @@ func (s *FlightService) Run(ctx context.Context) error {
 		log.Info().Msgf("got flight crash: %v", l)
 
 		// send flight to all WS clients
-		s.Ws.Broadcast <- l
+		s.broadcast(ws.CrashAdded, l)
 	})
 
 	if err != nil {
@@ -79,10 +92,40 @@ func (s *FlightService) Run(ctx context.Context) error {
 		log.Info().Msgf("Subscribed!")
 	}
 
+	// edits made through the REST API, possibly by other server instances
+	changes, err := s.nc.Subscribe(s.cfg.ChangesTopic, func(m *nats.Msg) {
+		var e model.ChangeEvent
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			log.Error().Msgf("can't unmarshall change event. err: %v", err)
+			return
+		}
+
+		log.Info().Msgf("got %s change of flight crash: %s", e.Type, e.ID)
+
+		switch {
+		case e.Type == model.Updated && e.Flight != nil:
+			s.broadcast(ws.CrashUpdated, e.Flight)
+		case e.Type == model.Deleted:
+			s.broadcast(ws.CrashDeleted, &ws.Deleted{ID: e.ID})
+		}
+	})
+
+	if err != nil {
+		log.Error().Msgf("Error during subscription to NATS topic: %s! err: %v", s.cfg.ChangesTopic, err)
+	}
+
+	if s.cfg.StatsTickInterval > 0 {
+		go s.tick(ctx, time.Duration(s.cfg.StatsTickInterval)*time.Second)
+	}
+
 	go func() {
 		<-ctx.Done()
 		log.Info().Msgf("Got cancel signal. Exiting Flight Service!")
+		s.broadcast(ws.ServerNotice, &ws.Notice{Level: "info", Message: "server is shutting down"})
 		sub.Unsubscribe()
+		if changes != nil {
+			changes.Unsubscribe()
+		}
 		wg.Done()
 	}()
 
@@ -90,9 +133,27 @@ func (s *FlightService) Run(ctx context.Context) error {
 	return nil
 }
 
-func (s *FlightService) Search(query string, from, to time.Time, size, skip int) (*Response, error) {
+// Search finds flight crashes matching the request. Without explicit sort
+// the best matches go first and the newest crashes among equally good ones.
+func (s *FlightService) Search(req *Request) (*Response, error) {
+	finder := s.finder(req).
+		Facets(req.Facets...).
+		Size(req.Size).
+		Skip(req.Skip).
+		After(req.Cursor).
+		Highlight(req.Highlight && req.Query != "")
+
+	if len(req.Sort) > 0 {
+		finder = finder.Sort(req.Sort...)
+	} else {
+		if req.Query != "" {
+			finder = finder.Sort("-_score")
+		}
+		finder = finder.Sort("-date")
+	}
+
 	// Create and execute finder
-	res, err := NewFinder().Query(query).From(from).To(to).Size(size).Skip(skip).Sort("-time").Find(s.esc)
+	res, err := finder.Find(s.esc)
 	if err != nil {
 		return nil, err
 	}
@@ -100,8 +161,23 @@ func (s *FlightService) Search(query string, from, to time.Time, size, skip int)
 	return res, nil
 }
 
-// Response holds information about queried data and total number of hits.
+// finder creates finder with the query and filters of the request.
+func (s *FlightService) finder(req *Request) *Finder {
+	return NewFinder().
+		Index(s.cfg.Index).
+		Query(req.Query).
+		From(req.From).
+		To(req.To).
+		TimeZone(req.TimeZone).
+		Filter(req.Filter).
+		Geo(req.Geo)
+}
+
+// Response holds information about queried data, total number of hits,
+// the facet counts when requested and the cursor of the next page.
 type Response struct {
-	Data  interface{} `json:"data,omitempty"`
-	Total int64       `json:"total,omitempty"`
+	Data   interface{}              `json:"data,omitempty"`
+	Total  int64                    `json:"total,omitempty"`
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+	Cursor string                   `json:"cursor,omitempty"`
 }
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/olivere/elastic"
+)
+
+// similarFields are compared to find crashes comparable to the given one.
+var similarFields = []string{"summary", "aircraftType", "route"}
+
+// Similar finds crashes with summary, aircraft type and route most like the
+// ones of the crash with given ID.
+func (s *FlightService) Similar(ctx context.Context, id string, size int) (*Response, error) {
+	// more_like_this silently returns nothing for missing document
+	if _, _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	q := elastic.NewMoreLikeThisQuery().
+		Field(similarFields...).
+		LikeItems(elastic.NewMoreLikeThisQueryItem().Index(s.cfg.Index).Type("flight").Id(id)).
+		MinTermFreq(1).
+		MinDocFreq(2).
+		MaxQueryTerms(25)
+
+	res, err := s.esc.Search().
+		Index(s.cfg.Index).
+		Type("flight").
+		Query(q).
+		Size(size).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flights := make([]model.FlightCrash, 0)
+	for _, hit := range res.Hits.Hits {
+		var flight model.FlightCrash
+		if err := json.Unmarshal(*hit.Source, &flight); err != nil {
+			return nil, err
+		}
+
+		flight.ID = hit.Id
+		flight.Score = hit.Score
+		flights = append(flights, flight)
+	}
+
+	return &Response{Data: flights, Total: res.Hits.TotalHits}, nil
+}
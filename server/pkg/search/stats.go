@@ -0,0 +1,181 @@
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/olivere/elastic"
+)
+
+// Intervals of the crash statistics.
+const (
+	Year   = "year"
+	Decade = "decade"
+)
+
+// fatalityRateScript computes fatalities/aboard of the crash.
+const fatalityRateScript = "doc['fatalities.total'].size() == 0 ? 0 : (double) doc['fatalities.total'].value / doc['aboard.total'].value"
+
+// fatalityRateInterval is the width of the fatality rate histogram buckets.
+const fatalityRateInterval = 0.1
+
+// Stats holds crash statistics of the flights matching the request.
+type Stats struct {
+	Crashes       int64         `json:"crashes"`
+	Fatalities    int64         `json:"fatalities"`
+	Ground        int64         `json:"ground"`
+	Periods       []PeriodStats `json:"periods"`
+	Operators     []TermStats   `json:"operators"`
+	AircraftTypes []TermStats   `json:"aircraftTypes"`
+	FatalityRate  []RateBucket  `json:"fatalityRate"`
+}
+
+// PeriodStats holds statistics of the year or decade, e.g. 1970 for 1970s.
+type PeriodStats struct {
+	Period     int   `json:"period"`
+	Crashes    int64 `json:"crashes"`
+	Fatalities int64 `json:"fatalities"`
+	Ground     int64 `json:"ground"`
+}
+
+// TermStats holds statistics of the single operator or aircraft type.
+type TermStats struct {
+	Key        string `json:"key"`
+	Crashes    int64  `json:"crashes"`
+	Fatalities int64  `json:"fatalities"`
+}
+
+// RateBucket holds the number of crashes with fatality rate in [From, To).
+type RateBucket struct {
+	From    float64 `json:"from"`
+	To      float64 `json:"to"`
+	Crashes int64   `json:"crashes"`
+}
+
+// Stats aggregates crashes matching the request per year or decade, finds
+// top operators and aircraft types and the distribution of fatality rate.
+func (s *FlightService) Stats(req *Request, interval string, top int) (*Stats, error) {
+	if interval != Year && interval != Decade {
+		return nil, &RequestError{Param: "interval", Reason: fmt.Sprintf("one of %s, %s expected", Year, Decade)}
+	}
+
+	query, err := s.finder(req).buildQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	periods := elastic.NewDateHistogramAggregation().
+		Field("date").
+		Interval("year").
+		MinDocCount(1)
+	if req.TimeZone != "" {
+		periods = periods.TimeZone(req.TimeZone)
+	}
+
+	fatalities := func() elastic.Aggregation { return elastic.NewSumAggregation().Field("fatalities.total") }
+	ground := func() elastic.Aggregation { return elastic.NewSumAggregation().Field("ground") }
+
+	res, err := s.esc.Search().
+		Index(s.cfg.Index).
+		Type("flight").
+		Query(query).
+		Size(0).
+		Aggregation("fatalities", fatalities()).
+		Aggregation("ground", ground()).
+		Aggregation("periods", periods.
+			SubAggregation("fatalities", fatalities()).
+			SubAggregation("ground", ground())).
+		Aggregation("operators", elastic.NewTermsAggregation().
+			Field("operator.keyword").
+			Size(top).
+			SubAggregation("fatalities", fatalities())).
+		Aggregation("aircraftTypes", elastic.NewTermsAggregation().
+			Field("aircraftType.keyword").
+			Size(top).
+			SubAggregation("fatalities", fatalities())).
+		Aggregation("fatalityRate", elastic.NewFilterAggregation().
+			Filter(elastic.NewRangeQuery("aboard.total").Gt(0)).
+			SubAggregation("histogram", elastic.NewHistogramAggregation().
+				Script(elastic.NewScript(fatalityRateScript)).
+				Interval(fatalityRateInterval).
+				MinDocCount(0))).
+		Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Fatalities:    sum(res.Aggregations, "fatalities"),
+		Ground:        sum(res.Aggregations, "ground"),
+		Periods:       make([]PeriodStats, 0),
+		Operators:     terms(res.Aggregations, "operators"),
+		AircraftTypes: terms(res.Aggregations, "aircraftTypes"),
+		FatalityRate:  make([]RateBucket, 0),
+	}
+
+	if res.Hits != nil {
+		stats.Crashes = res.Hits.TotalHits
+	}
+
+	if periods, found := res.Aggregations.DateHistogram("periods"); found {
+		loc := location(req.TimeZone)
+		for _, b := range periods.Buckets {
+			period := year(b.Key, loc)
+			if interval == Decade {
+				period = period / 10 * 10
+			}
+
+			// years come sorted, so the year falls into the last decade or starts the new one
+			if n := len(stats.Periods); n == 0 || stats.Periods[n-1].Period != period {
+				stats.Periods = append(stats.Periods, PeriodStats{Period: period})
+			}
+
+			p := &stats.Periods[len(stats.Periods)-1]
+			p.Crashes += b.DocCount
+			p.Fatalities += sum(b.Aggregations, "fatalities")
+			p.Ground += sum(b.Aggregations, "ground")
+		}
+	}
+
+	if rate, found := res.Aggregations.Filter("fatalityRate"); found {
+		if histogram, found := rate.Histogram("histogram"); found {
+			for _, b := range histogram.Buckets {
+				stats.FatalityRate = append(stats.FatalityRate, RateBucket{
+					From:    b.Key,
+					To:      b.Key + fatalityRateInterval,
+					Crashes: b.DocCount,
+				})
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// sum returns the value of the sum aggregation or 0 when it's missing.
+func sum(aggs elastic.Aggregations, name string) int64 {
+	if s, found := aggs.Sum(name); found && s.Value != nil {
+		return int64(*s.Value)
+	}
+	return 0
+}
+
+// terms returns the buckets of the terms aggregation with fatalities sum.
+func terms(aggs elastic.Aggregations, name string) []TermStats {
+	res := make([]TermStats, 0)
+
+	buckets, found := aggs.Terms(name)
+	if !found {
+		return res
+	}
+
+	for _, b := range buckets.Buckets {
+		res = append(res, TermStats{
+			Key:        fmt.Sprint(b.Key),
+			Crashes:    b.DocCount,
+			Fatalities: sum(b.Aggregations, "fatalities"),
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/mateuszdyminski/auto/server/pkg/ws"
+	"github.com/olivere/elastic"
+	"github.com/rs/zerolog/log"
+)
+
+// tick periodically sends the totals of the indexed crashes to the WebSocket clients.
+func (s *FlightService) tick(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats, err := s.totals(ctx)
+			if err != nil {
+				log.Error().Msgf("can't compute stats tick. err: %v", err)
+				continue
+			}
+
+			s.broadcast(ws.StatsTick, stats)
+		}
+	}
+}
+
+// totals counts all indexed crashes and their fatalities.
+func (s *FlightService) totals(ctx context.Context) (*ws.Stats, error) {
+	res, err := s.esc.Search().
+		Index(s.cfg.Index).
+		Type("flight").
+		Size(0).
+		Aggregation("fatalities", elastic.NewSumAggregation().Field("fatalities.total")).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ws.Stats{Crashes: res.Hits.TotalHits, Fatalities: sum(res.Aggregations, "fatalities")}, nil
+}
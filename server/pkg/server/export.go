@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/mateuszdyminski/auto/server/pkg/search"
+	"github.com/rs/zerolog/log"
+)
+
+// exportFlushEvery is the number of crashes written between flushes of the response.
+const exportFlushEvery = 100
+
+// csvHeader is the header of ingress data.csv file.
+var csvHeader = []string{"Date:", "Time:", "Location:", "Operator:", "Flight #:", "Route:", "AC  Type:", "Registration:", "cn / ln:", "Aboard:", "Fatalities:", "Ground:", "Summary:"}
+
+// exporter writes crashes in the single export format.
+type exporter interface {
+	begin() error
+	write(flight *model.FlightCrash) error
+	end() error
+}
+
+// export streams all crashes matching the search parameters as csv, ndjson or geojson.
+func (s *Server) export(w http.ResponseWriter, req *http.Request) {
+	params, err := parseSearchRequest(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var exp exporter
+	format := req.URL.Query().Get("format")
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		exp = &csvExporter{w: csv.NewWriter(w)}
+	case "ndjson", "":
+		format = "ndjson"
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		exp = &ndjsonExporter{enc: json.NewEncoder(w)}
+	case "geojson":
+		w.Header().Set("Content-Type", "application/geo+json")
+		exp = &geoJSONExporter{w: w}
+	default:
+		writeError(w, &search.RequestError{Param: "format", Reason: "one of csv, ndjson, geojson expected"})
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=flights.%s", format))
+
+	// export can take longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn().Msgf("can't clear write deadline of export. err: %v", err)
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	if err := exp.begin(); err != nil {
+		log.Error().Msgf("can't export flights. err: %v", err)
+		return
+	}
+
+	var written int
+	err = s.service.Export(req.Context(), params, func(flight *model.FlightCrash) error {
+		if err := exp.write(flight); err != nil {
+			return err
+		}
+
+		written++
+		if flusher != nil && written%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		// headers are gone already, so the client gets truncated export
+		log.Error().Msgf("can't export flights. err: %v", err)
+		return
+	}
+
+	if err := exp.end(); err != nil {
+		log.Error().Msgf("can't export flights. err: %v", err)
+	}
+}
+
+// ndjsonExporter writes one JSON crash per line.
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) begin() error { return nil }
+
+func (e *ndjsonExporter) write(flight *model.FlightCrash) error { return e.enc.Encode(flight) }
+
+func (e *ndjsonExporter) end() error { return nil }
+
+// csvExporter writes crashes in the column layout of ingress data.csv, so the
+// export can be ingested again.
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvExporter) write(f *model.FlightCrash) error {
+	return e.w.Write([]string{
+		f.Date.Format("January 02, 2006"),
+		crashTime(f),
+		orUnknown(f.Location),
+		orUnknown(f.Operator),
+		orUnknown(f.FlightNo),
+		orUnknown(f.Route),
+		orUnknown(f.AircraftType),
+		orUnknown(f.Registration),
+		orUnknown(f.SerialNumber),
+		formatAboard(f.Aboard),
+		formatAboard(f.Fatalities),
+		strconv.Itoa(f.Ground),
+		orUnknown(f.Summary),
+	})
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// crashTime returns the local time of the crash or "?" when only the day is known.
+func crashTime(f *model.FlightCrash) string {
+	if f.TimeUnknown {
+		return "?"
+	}
+	return f.Date.Format("15:04")
+}
+
+// orUnknown returns "?" which marks unknown values in data.csv.
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
+
+// formatAboard formats people on board as in data.csv: 7 (passengers:6 crew:1).
+func formatAboard(a model.Aboard) string {
+	return fmt.Sprintf("%d (passengers:%d crew:%d)", a.Total, a.Passengers, a.Crew)
+}
+
+// geoJSONExporter writes crashes as features of a GeoJSON FeatureCollection.
+// Crashes without coordinates get null geometry.
+type geoJSONExporter struct {
+	w       io.Writer
+	written bool
+}
+
+type geoJSONFeature struct {
+	Type       string             `json:"type"`
+	ID         string             `json:"id,omitempty"`
+	Geometry   *geoJSONPoint      `json:"geometry"`
+	Properties *model.FlightCrash `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func (e *geoJSONExporter) begin() error {
+	_, err := io.WriteString(e.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (e *geoJSONExporter) write(f *model.FlightCrash) error {
+	feature := geoJSONFeature{Type: "Feature", ID: f.ID, Properties: f}
+	if f.LocationGPS != nil {
+		// GeoJSON positions are [lon, lat]
+		feature.Geometry = &geoJSONPoint{Type: "Point", Coordinates: [2]float64{f.LocationGPS.Longitude, f.LocationGPS.Latitude}}
+	}
+
+	data, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+
+	if e.written {
+		data = append([]byte(","), data...)
+	}
+	e.written = true
+
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *geoJSONExporter) end() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
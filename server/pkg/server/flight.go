@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/mateuszdyminski/auto/server/pkg/search"
+)
+
+// flight serves the single flight crash under /api/flights/{id}. Writes have
+// to send the ETag from GET in If-Match header, stale writes are rejected
+// with 412 Precondition Failed. /api/flights/{id}/similar returns the
+// comparable crashes.
+func (s *Server) flight(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/api/flights/")
+	if i := strings.Index(id, "/"); i > 0 && id[i:] == "/similar" {
+		s.similar(w, req, id[:i])
+		return
+	}
+
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		s.getFlight(w, req, id)
+	case http.MethodPut:
+		s.putFlight(w, req, id)
+	case http.MethodPatch:
+		s.patchFlight(w, req, id)
+	case http.MethodDelete:
+		s.deleteFlight(w, req, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) getFlight(w http.ResponseWriter, req *http.Request, id string) {
+	flight, version, err := s.service.Get(req.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, version)
+	writeJSON(w, flight)
+}
+
+func (s *Server) putFlight(w http.ResponseWriter, req *http.Request, id string) {
+	version, ok := ifMatch(w, req, true)
+	if !ok {
+		return
+	}
+
+	var flight model.FlightCrash
+	if err := json.NewDecoder(req.Body).Decode(&flight); err != nil {
+		writeError(w, &search.RequestError{Param: "body", Reason: "flight crash JSON expected"})
+		return
+	}
+
+	newVersion, err := s.service.Replace(req.Context(), id, &flight, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, newVersion)
+	writeJSON(w, flight)
+}
+
+// patchFlight applies JSON merge patch. If-Match is optional here, without
+// it the patch is applied to the current version.
+func (s *Server) patchFlight(w http.ResponseWriter, req *http.Request, id string) {
+	version, ok := ifMatch(w, req, false)
+	if !ok {
+		return
+	}
+
+	patch, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	flight, newVersion, err := s.service.Patch(req.Context(), id, patch, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, newVersion)
+	writeJSON(w, flight)
+}
+
+func (s *Server) deleteFlight(w http.ResponseWriter, req *http.Request, id string) {
+	version, ok := ifMatch(w, req, true)
+	if !ok {
+		return
+	}
+
+	if err := s.service.Delete(req.Context(), id, version); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// similar returns l (default 10, at most 100) crashes most like the given one.
+func (s *Server) similar(w http.ResponseWriter, req *http.Request, id string) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	size := 10
+	if l := req.URL.Query().Get("l"); l != "" {
+		var err error
+		if size, err = strconv.Atoi(l); err != nil || size < 1 || size > 100 {
+			writeError(w, &search.RequestError{Param: "l", Reason: "integer between 1 and 100 expected"})
+			return
+		}
+	}
+
+	flights, err := s.service.Similar(req.Context(), id, size)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, flights)
+}
+
+// ifMatch parses the version from If-Match header. It responds with 428
+// Precondition Required when the header is required but missing.
+func ifMatch(w http.ResponseWriter, req *http.Request, required bool) (*search.Version, bool) {
+	etag := req.Header.Get("If-Match")
+	if etag == "" {
+		if required {
+			w.WriteHeader(http.StatusPreconditionRequired)
+			w.Write([]byte("If-Match header required"))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	version, err := search.ParseVersion(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`))
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+
+	return version, true
+}
+
+func setETag(w http.ResponseWriter, version *search.Version) {
+	w.Header().Set("ETag", `"`+version.String()+`"`)
+}
@@ -7,62 +7,116 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/mateuszdyminski/auto/server/pkg/search"
 	"github.com/mateuszdyminski/auto/server/pkg/version"
 	"github.com/mateuszdyminski/auto/server/pkg/ws"
 	"github.com/rs/zerolog/log"
 )
 
 func (s *Server) search(w http.ResponseWriter, req *http.Request) {
-	from := req.URL.Query().Get("from") + "+01:00"
-	to := req.URL.Query().Get("to") + "+01:00"
-	query := req.URL.Query().Get("query")
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
-	size, err := strconv.Atoi(req.URL.Query().Get("l"))
+	params, err := parseSearchRequest(req)
 	if err != nil {
-		size = 100
+		writeError(w, err)
+		return
 	}
 
-	skip, err := strconv.Atoi(req.URL.Query().Get("s"))
+	flights, err := s.service.Search(params)
 	if err != nil {
-		skip = 0
+		writeError(w, err)
+		return
 	}
 
-	fromTime := time.Time{}
-	if from != "" {
-		if fromTime, err = time.Parse(time.RFC3339, from); err != nil {
-			log.Warn().Msgf("Can't parse 'from' time: %s", from)
-		}
+	writeJSON(w, flights)
+}
+
+// clusters groups crashes matching the search parameters into geohash grid
+// cells for the map. Precision of the grid depends on the zoom parameter.
+func (s *Server) clusters(w http.ResponseWriter, req *http.Request) {
+	params, err := parseSearchRequest(req)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	toTime := time.Time{}
-	if to != "" {
-		if toTime, err = time.Parse(time.RFC3339, to); err != nil {
-			log.Warn().Msgf("Can't parse 'to' time: %s", to)
-		}
+	zoom, err := strconv.Atoi(req.URL.Query().Get("zoom"))
+	if err != nil || zoom < 0 || zoom > 22 {
+		writeError(w, &search.RequestError{Param: "zoom", Reason: "integer between 0 and 22 expected"})
+		return
 	}
 
-	logs, err := s.service.Search(query, fromTime, toTime, size, skip)
+	clusters, err := s.service.Clusters(params, zoom)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, err)
 		return
 	}
 
-	json, err := json.Marshal(logs)
+	writeJSON(w, clusters)
+}
+
+// stats returns statistics of the crashes matching the search parameters.
+// interval is year (default) or decade, top is the number of the top
+// operators and aircraft types.
+func (s *Server) stats(w http.ResponseWriter, req *http.Request) {
+	params, err := parseSearchRequest(req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, err)
+		return
+	}
+
+	interval := req.URL.Query().Get("interval")
+	if interval == "" {
+		interval = search.Year
+	}
+
+	top := 10
+	if t := req.URL.Query().Get("top"); t != "" {
+		if top, err = strconv.Atoi(t); err != nil || top < 1 || top > 100 {
+			writeError(w, &search.RequestError{Param: "top", Reason: "integer between 1 and 100 expected"})
+			return
+		}
+	}
+
+	stats, err := s.service.Stats(params, interval, top)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	w.Write(json)
+	writeJSON(w, stats)
 }
 
-// serverWs handles websocket requests from the peer.
+// serveWs streams the flight crashes over WebSocket. Clients requesting
+// auto.v2 subprotocol get all events in envelopes, the others bare added and
+// updated crashes. Handshake may carry:
+//
+//	since=2018-05-01T10:00:00Z     replay events published after the time
+//	lastEventId=...                replay events after the one with the event or crash ID
+//	bbox=...&operator=...          initial subscription, see parseSubscription
 func (s *Server) serveWs(w http.ResponseWriter, req *http.Request) {
 	log.Info().Msgf("Registering client for WS")
 
+	values := req.URL.Query()
+
+	var since time.Time
+	if v := values.Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, &search.RequestError{Param: "since", Reason: "RFC3339 time expected"})
+			return
+		}
+	}
+
+	subscription, err := parseSubscription(values)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	ws.Upgrader.CheckOrigin = func(r *http.Request) bool {
 		return true
 	}
@@ -73,9 +127,16 @@ func (s *Server) serveWs(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	c := &ws.Connection{Send: make(chan *model.FlightCrash, 256), Ws: upg}
-	s.service.Ws.Register <- c
+	protocol := upg.Subprotocol()
+	if protocol == "" {
+		protocol = ws.ProtocolV1
+	}
+
+	c := &ws.Connection{Send: make(chan *ws.Event, 256), Ws: upg, Protocol: protocol}
+	c.Subscribe(subscription)
+	s.service.Connect(c, since, values.Get("lastEventId"))
 	go c.WritePump()
+	go c.ReadPump(s.service.Ws)
 }
 
 func (s *Server) version(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+	"github.com/mateuszdyminski/auto/server/pkg/search"
+	"github.com/mateuszdyminski/auto/server/pkg/ws"
+)
+
+// distance matches Elasticsearch distances like 50km or 10.5mi.
+var distance = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(mi|miles|yd|yards|ft|feet|in|inch|km|kilometers|m|meters|cm|centimeters|mm|millimeters|NM|nmi|nauticalmiles)$`)
+
+// parseSearchRequest reads search parameters from the URL query:
+//
+//	query=engine failure           full-text query
+//	from=1990-01-01&to=now         date range, RFC3339 time, date or relative date like now-10y
+//	tz=Europe/Warsaw               time zone of the dates without offset, defaults to UTC
+//	operator=Aeroflot              term filter, repeat to match any of the values
+//	aircraftType=Tupolev*          '*' and '?' work as wildcards
+//	operator=!Aeroflot             '!' excludes the matching crashes
+//	minFatalities=51&maxAboard=100 range filters on fatalities, aboard and ground
+//	decade=1970                    crashes from 1970-1979, repeat to match any of the decades
+//	match=any                      combine filters with OR instead of AND
+//	bbox=west,south,east,north     crashes in the bounding box
+//	near=lat,lon&radius=50km       crashes in the circle, radius defaults to 100km
+//	sort=-fatalities,date          sort order, "distance" sorts by distance from near
+//	facets=operator:5,decade       facet counts with optional size
+//	l=100&s=0                      page size and offset, limited to the first 10000 hits
+//	cursor=...                     next page after the cursor returned with the previous one
+//	highlight=true                 summary fragments matching the query
+//
+// POST request may carry GeoJSON polygon in the body to search in.
+func parseSearchRequest(req *http.Request) (*search.Request, error) {
+	values := req.URL.Query()
+
+	res := &search.Request{Query: values.Get("query"), Cursor: values.Get("cursor"), Size: 100}
+
+	var err error
+	if l := values.Get("l"); l != "" {
+		if res.Size, err = strconv.Atoi(l); err != nil || res.Size < 0 {
+			return nil, &search.RequestError{Param: "l", Reason: "non-negative integer expected"}
+		}
+	}
+
+	if s := values.Get("s"); s != "" {
+		if res.Skip, err = strconv.Atoi(s); err != nil || res.Skip < 0 {
+			return nil, &search.RequestError{Param: "s", Reason: "non-negative integer expected"}
+		}
+	}
+
+	if from := values.Get("from"); from != "" {
+		if res.From, err = search.DateBound("from", from, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if to := values.Get("to"); to != "" {
+		if res.To, err = search.DateBound("to", to, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if tz := values.Get("tz"); tz != "" {
+		if err := search.ValidTimeZone(tz); err != nil {
+			return nil, err
+		}
+		res.TimeZone = tz
+	}
+
+	if h := values.Get("highlight"); h != "" {
+		if res.Highlight, err = strconv.ParseBool(h); err != nil {
+			return nil, &search.RequestError{Param: "highlight", Reason: "boolean expected"}
+		}
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		res.Sort = strings.Split(sort, ",")
+	}
+
+	if res.Filter, err = parseFilter(values); err != nil {
+		return nil, err
+	}
+	res.Filter.TimeZone = res.TimeZone
+
+	if res.Geo, err = parseGeoFilter(req); err != nil {
+		return nil, err
+	}
+
+	if facets := values.Get("facets"); facets != "" {
+		for _, f := range strings.Split(facets, ",") {
+			facet := search.Facet{Field: strings.TrimSpace(f)}
+			if i := strings.Index(facet.Field, ":"); i >= 0 {
+				size, err := strconv.Atoi(facet.Field[i+1:])
+				if err != nil || size < 1 {
+					return nil, &search.RequestError{Param: "facets", Reason: fmt.Sprintf("wrong size of facet %s", f)}
+				}
+				facet.Field, facet.Size = facet.Field[:i], size
+			}
+			res.Facets = append(res.Facets, facet)
+		}
+	}
+
+	return res, nil
+}
+
+// parseGeoFilter reads bounding box and circle from the URL query and polygon
+// from the request body.
+func parseGeoFilter(req *http.Request) (*search.GeoFilter, error) {
+	values := req.URL.Query()
+	geo := &search.GeoFilter{}
+
+	if bbox := values.Get("bbox"); bbox != "" {
+		c, err := parseFloats(bbox, 4)
+		if err != nil {
+			return nil, &search.RequestError{Param: "bbox", Reason: "west,south,east,north expected"}
+		}
+
+		geo.BBox = &search.BoundingBox{West: c[0], South: c[1], East: c[2], North: c[3]}
+		if !validLocation(geo.BBox.South, geo.BBox.West) || !validLocation(geo.BBox.North, geo.BBox.East) || geo.BBox.South > geo.BBox.North {
+			return nil, &search.RequestError{Param: "bbox", Reason: "coordinates out of range"}
+		}
+	}
+
+	if near := values.Get("near"); near != "" {
+		c, err := parseFloats(near, 2)
+		if err != nil || !validLocation(c[0], c[1]) {
+			return nil, &search.RequestError{Param: "near", Reason: "lat,lon expected"}
+		}
+
+		geo.Near = &model.Location{Latitude: c[0], Longitude: c[1]}
+		geo.Radius = values.Get("radius")
+		if geo.Radius == "" {
+			geo.Radius = "100km"
+		}
+		if !distance.MatchString(geo.Radius) {
+			return nil, &search.RequestError{Param: "radius", Reason: "distance with unit expected, e.g. 50km"}
+		}
+	} else if values.Get("radius") != "" {
+		return nil, &search.RequestError{Param: "radius", Reason: "near parameter is required"}
+	}
+
+	if req.Method == http.MethodPost && req.Body != nil {
+		polygon, err := parsePolygon(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		geo.Polygon = polygon
+	}
+
+	return geo, nil
+}
+
+// parsePolygon decodes GeoJSON Polygon geometry, or Feature with such
+// geometry. Only the outer ring of the polygon is used.
+func parsePolygon(body io.Reader) ([]model.Location, error) {
+	var geoJSON struct {
+		Type        string        `json:"type"`
+		Coordinates [][][]float64 `json:"coordinates"`
+		Geometry    *struct {
+			Type        string        `json:"type"`
+			Coordinates [][][]float64 `json:"coordinates"`
+		} `json:"geometry"`
+	}
+
+	if err := json.NewDecoder(body).Decode(&geoJSON); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, &search.RequestError{Param: "body", Reason: fmt.Sprintf("can't decode GeoJSON: %v", err)}
+	}
+
+	typ, coordinates := geoJSON.Type, geoJSON.Coordinates
+	if typ == "Feature" && geoJSON.Geometry != nil {
+		typ, coordinates = geoJSON.Geometry.Type, geoJSON.Geometry.Coordinates
+	}
+
+	if typ != "Polygon" || len(coordinates) == 0 || len(coordinates[0]) < 3 {
+		return nil, &search.RequestError{Param: "body", Reason: "GeoJSON Polygon with at least 3 points expected"}
+	}
+
+	var polygon []model.Location
+	for _, p := range coordinates[0] {
+		// GeoJSON positions are [lon, lat]
+		if len(p) < 2 || !validLocation(p[1], p[0]) {
+			return nil, &search.RequestError{Param: "body", Reason: "wrong polygon position"}
+		}
+		polygon = append(polygon, model.Location{Latitude: p[1], Longitude: p[0]})
+	}
+
+	return polygon, nil
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%d comma separated numbers expected", n)
+	}
+
+	res := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = f
+	}
+
+	return res, nil
+}
+
+func validLocation(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// parseSubscription reads the initial WebSocket subscription from the URL
+// query: bbox=west,south,east,north, operator, aircraftType, minFatalities
+// and RFC3339 from and to. It returns nil when none is set.
+func parseSubscription(values url.Values) (*ws.Subscription, error) {
+	sub := &ws.Subscription{Operator: values.Get("operator"), AircraftType: values.Get("aircraftType")}
+	set := sub.Operator != "" || sub.AircraftType != ""
+
+	if bbox := values.Get("bbox"); bbox != "" {
+		c, err := parseFloats(bbox, 4)
+		if err != nil || !validLocation(c[1], c[0]) || !validLocation(c[3], c[2]) || c[1] > c[3] {
+			return nil, &search.RequestError{Param: "bbox", Reason: "west,south,east,north expected"}
+		}
+		sub.BBox, set = &ws.BoundingBox{West: c[0], South: c[1], East: c[2], North: c[3]}, true
+	}
+
+	if m := values.Get("minFatalities"); m != "" {
+		var err error
+		if sub.MinFatalities, err = strconv.Atoi(m); err != nil || sub.MinFatalities < 0 {
+			return nil, &search.RequestError{Param: "minFatalities", Reason: "non-negative integer expected"}
+		}
+		set = true
+	}
+
+	for param, t := range map[string]*time.Time{"from": &sub.From, "to": &sub.To} {
+		if v := values.Get(param); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, &search.RequestError{Param: param, Reason: "RFC3339 time expected"}
+			}
+			set = true
+		}
+	}
+
+	if !set {
+		return nil, nil
+	}
+	return sub, nil
+}
+
+// parseFilter reads term and range filters from the URL query.
+func parseFilter(values url.Values) (*search.Filter, error) {
+	filter := &search.Filter{}
+
+	switch values.Get("match") {
+	case "", "all":
+	case "any":
+		filter.Any = true
+	default:
+		return nil, &search.RequestError{Param: "match", Reason: "one of all, any expected"}
+	}
+
+	for _, field := range search.TermFields() {
+		include := search.TermFilter{Field: field}
+		exclude := search.TermFilter{Field: field, Not: true}
+		for _, v := range values[field] {
+			v = strings.TrimSpace(v)
+			switch {
+			case v == "" || v == "!":
+				return nil, &search.RequestError{Param: field, Reason: "empty value"}
+			case strings.HasPrefix(v, "!"):
+				exclude.Values = append(exclude.Values, v[1:])
+			default:
+				include.Values = append(include.Values, v)
+			}
+		}
+
+		if len(include.Values) > 0 {
+			filter.Terms = append(filter.Terms, include)
+		}
+		if len(exclude.Values) > 0 {
+			filter.Terms = append(filter.Terms, exclude)
+		}
+	}
+
+	for _, d := range values["decade"] {
+		decade, err := strconv.Atoi(d)
+		if err != nil || decade%10 != 0 {
+			return nil, &search.RequestError{Param: "decade", Reason: fmt.Sprintf("year divisible by 10 expected, got %q", d)}
+		}
+		filter.Decades = append(filter.Decades, decade)
+	}
+
+	for _, field := range search.RangeFields() {
+		suffix := strings.ToUpper(field[:1]) + field[1:]
+
+		min, err := parseOptionalInt(values, "min"+suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := parseOptionalInt(values, "max"+suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		if min != nil || max != nil {
+			filter.Ranges = append(filter.Ranges, search.RangeFilter{Field: field, Min: min, Max: max})
+		}
+	}
+
+	return filter, nil
+}
+
+// parseOptionalInt returns nil when the parameter is not set.
+func parseOptionalInt(values url.Values, param string) (*int, error) {
+	v := values.Get(param)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, &search.RequestError{Param: param, Reason: fmt.Sprintf("integer expected, got %q", v)}
+	}
+
+	return &n, nil
+}
+
+// writeJSON responds with v marshaled to JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// writeError responds with 400 for malformed requests and 500 otherwise.
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case search.IsRequestError(err):
+		w.WriteHeader(http.StatusBadRequest)
+	case err == search.ErrNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case err == search.ErrConflict:
+		w.WriteHeader(http.StatusPreconditionFailed)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write([]byte(err.Error()))
+}
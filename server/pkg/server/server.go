@@ -35,6 +35,11 @@ func NewServer(service *search.FlightService, options ...func(*Server)) *Server
 
 	// register flights handlers
 	s.mux.HandleFunc("/api/flights", s.search)
+	s.mux.HandleFunc("/api/flights/clusters", s.clusters)
+	s.mux.HandleFunc("/api/flights/export", s.export)
+	s.mux.HandleFunc("/api/flights/stream", s.stream)
+	s.mux.HandleFunc("/api/flights/", s.flight)
+	s.mux.HandleFunc("/api/stats", s.stats)
 	s.mux.HandleFunc("/wsapi/ws", s.serveWs)
 
 	// register generic handlers
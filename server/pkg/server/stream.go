@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mateuszdyminski/auto/server/pkg/search"
+	"github.com/mateuszdyminski/auto/server/pkg/ws"
+	"github.com/rs/zerolog/log"
+)
+
+// heartbeatPeriod keeps proxies from closing the idle event stream.
+const heartbeatPeriod = 15 * time.Second
+
+// stream is the Server-Sent Events fallback of the WebSocket feed for the
+// clients behind proxies which break WebSockets. Events are the auto.v2
+// ones: the event type, JSON payload and "<boot>-<seq>" as the event ID.
+// Query takes the since parameter and the filters of the WebSocket
+// handshake, the Last-Event-ID header (or lastEventId parameter) with that
+// ID resumes the stream.
+func (s *Server) stream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	values := req.URL.Query()
+
+	var since time.Time
+	if v := values.Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, &search.RequestError{Param: "since", Reason: "RFC3339 time expected"})
+			return
+		}
+	}
+
+	lastID := req.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = values.Get("lastEventId")
+	}
+
+	subscription, err := parseSubscription(values)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// stream lasts longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn().Msgf("can't clear write deadline of event stream. err: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	log.Info().Msgf("Registering client for event stream")
+
+	c := &ws.Connection{Send: make(chan *ws.Event, 256), Protocol: ws.ProtocolV2}
+	c.Subscribe(subscription)
+	s.service.Connect(c, since, lastID)
+	defer func() {
+		s.service.Ws.Unregister <- c
+	}()
+
+	for _, e := range c.Replay {
+		if !c.Matches(e) {
+			continue
+		}
+
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	c.Replay = nil
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatPeriod)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case e, ok := <-c.Send:
+			if !ok {
+				code, reason := c.CloseReason()
+				writeEvent(w, &ws.Event{Type: ws.ServerNotice, Time: time.Now(), Payload: &ws.Notice{
+					Level:   "error",
+					Message: fmt.Sprintf("%s (%d)", reason, code),
+				}})
+				return
+			}
+
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes the event in the text/event-stream format.
+func writeEvent(w http.ResponseWriter, e *ws.Event) error {
+	env, err := e.Envelope()
+	if err != nil {
+		log.Error().Msgf("can't marshal event for event stream. err: %v", err)
+		return err
+	}
+
+	if env.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", env.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", env.Type, env.Payload)
+	return err
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+)
+
+// WebSocket subprotocols negotiated with Sec-WebSocket-Protocol header.
+// ProtocolV1 is also used when the client doesn't request any.
+const (
+	// ProtocolV1 sends bare flight crash JSON of the added and updated crashes.
+	ProtocolV1 = "auto.v1"
+
+	// ProtocolV2 sends all events wrapped in Envelope.
+	ProtocolV2 = "auto.v2"
+)
+
+// Types of the events.
+const (
+	CrashAdded   = "crash-added"
+	CrashUpdated = "crash-updated"
+	CrashDeleted = "crash-deleted"
+	StatsTick    = "stats-tick"
+	ServerNotice = "server-notice"
+
+	// CrashesSkipped summarizes the events skipped for the slow consumer.
+	CrashesSkipped = "crashes-skipped"
+)
+
+// Envelope wraps every message of ProtocolV2. Seq grows by one with every
+// event published by the server instance and starts over when it restarts.
+// ID is "<boot>-<seq>" and can be sent back as lastEventId to replay the
+// missed events. Stats ticks and the notices sent to a single client have
+// zero Seq and no ID.
+type Envelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Seq     uint64          `json:"seq"`
+	Time    time.Time       `json:"ts"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Deleted is the payload of CrashDeleted.
+type Deleted struct {
+	ID string `json:"id"`
+}
+
+// Stats is the payload of StatsTick.
+type Stats struct {
+	Crashes    int64 `json:"crashes"`
+	Fatalities int64 `json:"fatalities"`
+}
+
+// Notice is the payload of ServerNotice.
+type Notice struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// Skipped is the payload of CrashesSkipped. The skipped events can be
+// replayed by reconnecting with lastEventId of the event received before.
+type Skipped struct {
+	Count    int    `json:"count"`
+	FirstSeq uint64 `json:"firstSeq,omitempty"`
+	LastSeq  uint64 `json:"lastSeq,omitempty"`
+}
+
+// Event is published through the hub to the connections.
+type Event struct {
+	Type    string
+	ID      string
+	Seq     uint64
+	Time    time.Time
+	Payload interface{}
+}
+
+// Flight returns the crash carried by the event, nil for the other events.
+func (e *Event) Flight() *model.FlightCrash {
+	f, _ := e.Payload.(*model.FlightCrash)
+	return f
+}
+
+// Envelope wraps the event for ProtocolV2.
+func (e *Event) Envelope() (*Envelope, error) {
+	payload, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{Type: e.Type, ID: e.ID, Seq: e.Seq, Time: e.Time, Payload: payload}, nil
+}
+
+// Flight decodes the payload of CrashAdded and CrashUpdated.
+func (e *Envelope) Flight() (*model.FlightCrash, error) {
+	f := new(model.FlightCrash)
+	return f, json.Unmarshal(e.Payload, f)
+}
+
+// Deleted decodes the payload of CrashDeleted.
+func (e *Envelope) Deleted() (*Deleted, error) {
+	d := new(Deleted)
+	return d, json.Unmarshal(e.Payload, d)
+}
+
+// Stats decodes the payload of StatsTick.
+func (e *Envelope) Stats() (*Stats, error) {
+	s := new(Stats)
+	return s, json.Unmarshal(e.Payload, s)
+}
+
+// Skipped decodes the payload of CrashesSkipped.
+func (e *Envelope) Skipped() (*Skipped, error) {
+	s := new(Skipped)
+	return s, json.Unmarshal(e.Payload, s)
+}
+
+// Notice decodes the payload of ServerNotice.
+func (e *Envelope) Notice() (*Notice, error) {
+	n := new(Notice)
+	return n, json.Unmarshal(e.Payload, n)
+}
@@ -5,9 +5,33 @@
 package ws
 
 import (
-	"github.com/mateuszdyminski/auto/ingress/model"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// Policies applied to the connections which don't keep up with the feed.
+const (
+	// Disconnect closes the connection with CloseSlowConsumer code.
+	Disconnect = "disconnect"
+
+	// DropOldest drops the oldest queued event to make room for the new one.
+	DropOldest = "drop-oldest"
+
+	// Coalesce skips the events until there is room in the queue and then
+	// sends CrashesSkipped summary of them. ProtocolV1 clients can't get
+	// the summary, so the oldest events are dropped for them instead.
+	Coalesce = "coalesce"
 )
 
+// CloseSlowConsumer is the close code sent to the disconnected slow consumers.
+const CloseSlowConsumer = 4008
+
+// summaryPeriod is how often the pending summaries of skipped events are retried.
+const summaryPeriod = time.Second
+
 // hub maintains the set of active connections and broadcasts messages to the
 // connections.
 type Hub struct {
@@ -15,43 +39,190 @@ type Hub struct {
 	Connections map[*Connection]bool
 
 	// Inbound messages from the connections.
-	Broadcast chan *model.FlightCrash
+	Broadcast chan *Event
 
 	// Register requests from the connections.
 	Register chan *Connection
 
 	// Unregister requests from connections.
 	Unregister chan *Connection
+
+	policy      string
+	connections prometheus.Gauge
+	queueDepth  prometheus.Histogram
+	dropped     prometheus.Counter
+	disconnects *prometheus.CounterVec
+	lifetime    prometheus.Histogram
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Broadcast:   make(chan *model.FlightCrash),
+func NewHub(policy string) (*Hub, error) {
+	switch policy {
+	case "":
+		policy = Disconnect
+	case Disconnect, DropOldest, Coalesce:
+	default:
+		return nil, fmt.Errorf("unknown slow consumer policy: %s", policy)
+	}
+
+	h := &Hub{
+		Broadcast:   make(chan *Event),
 		Register:    make(chan *Connection),
 		Unregister:  make(chan *Connection),
 		Connections: make(map[*Connection]bool),
+		policy:      policy,
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Subsystem: "ws",
+			Name:      "connections",
+			Help:      "The number of connected live feed clients.",
+		}),
+		queueDepth: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Subsystem: "ws",
+			Name:      "queue_depth",
+			Help:      "The number of events queued for the connection after enqueuing a new one.",
+			Buckets:   []float64{0, 1, 4, 16, 64, 128, 192, 256},
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "ws",
+			Name:      "dropped_messages_total",
+			Help:      "The total number of events dropped or skipped for the slow consumers.",
+		}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "ws",
+			Name:      "disconnects_total",
+			Help:      "The total number of disconnected live feed clients.",
+		}, []string{"reason"}),
+		lifetime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Subsystem: "ws",
+			Name:      "connection_lifetime_seconds",
+			Help:      "How long the live feed clients stay connected.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+		}),
 	}
+
+	prometheus.MustRegister(h.connections, h.queueDepth, h.dropped, h.disconnects, h.lifetime)
+
+	return h, nil
 }
 
 func (h *Hub) Run() {
+	ticker := time.NewTicker(summaryPeriod)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case c := <-h.Register:
 			h.Connections[c] = true
+			c.connected = time.Now()
+			h.connections.Inc()
 		case c := <-h.Unregister:
 			if _, ok := h.Connections[c]; ok {
-				delete(h.Connections, c)
-				close(c.Send)
+				h.remove(c, "client")
 			}
 		case m := <-h.Broadcast:
 			for c := range h.Connections {
-				select {
-				case c.Send <- m:
-				default:
-					close(c.Send)
-					delete(h.Connections, c)
+				if !c.Matches(m) {
+					continue
+				}
+
+				h.send(c, m)
+			}
+		case <-ticker.C:
+			for c := range h.Connections {
+				if c.skipped != nil {
+					h.flushSkipped(c)
 				}
 			}
 		}
 	}
 }
+
+// send queues the event for the connection applying the slow consumer
+// policy when the queue is full.
+func (h *Hub) send(c *Connection, e *Event) {
+	// skipped events are summarized before the new ones
+	if c.skipped != nil && !h.flushSkipped(c) {
+		h.skip(c, e)
+		return
+	}
+
+	if h.enqueue(c, e) {
+		return
+	}
+
+	switch h.policy {
+	case DropOldest:
+		h.dropOldest(c, e)
+	case Coalesce:
+		if c.Protocol != ProtocolV2 {
+			// the client wouldn't know about the skipped events
+			h.dropOldest(c, e)
+			return
+		}
+		h.skip(c, e)
+	default:
+		c.closeCode, c.closeText = CloseSlowConsumer, "slow consumer"
+		h.remove(c, "slow-consumer")
+	}
+}
+
+// dropOldest drops the oldest queued event to make room for the new one.
+func (h *Hub) dropOldest(c *Connection, e *Event) {
+	select {
+	case <-c.Send:
+		c.dropped++
+		h.dropped.Inc()
+	default:
+	}
+	h.enqueue(c, e)
+}
+
+func (h *Hub) enqueue(c *Connection, e *Event) bool {
+	select {
+	case c.Send <- e:
+		h.queueDepth.Observe(float64(len(c.Send)))
+		return true
+	default:
+		return false
+	}
+}
+
+// skip adds the event to the summary of the skipped events.
+func (h *Hub) skip(c *Connection, e *Event) {
+	if c.skipped == nil {
+		c.skipped = &Skipped{}
+	}
+
+	c.skipped.Count++
+	if e.Seq > 0 {
+		if c.skipped.FirstSeq == 0 {
+			c.skipped.FirstSeq = e.Seq
+		}
+		c.skipped.LastSeq = e.Seq
+	}
+
+	c.dropped++
+	h.dropped.Inc()
+}
+
+// flushSkipped tries to queue the summary of the skipped events.
+func (h *Hub) flushSkipped(c *Connection) bool {
+	if !h.enqueue(c, &Event{Type: CrashesSkipped, Time: time.Now(), Payload: c.skipped}) {
+		return false
+	}
+
+	c.skipped = nil
+	return true
+}
+
+// remove unregisters the connection and closes its queue.
+func (h *Hub) remove(c *Connection, reason string) {
+	delete(h.Connections, c)
+	close(c.Send)
+
+	lifetime := time.Since(c.connected)
+	h.connections.Dec()
+	h.disconnects.WithLabelValues(reason).Inc()
+	h.lifetime.Observe(lifetime.Seconds())
+
+	log.Info().Msgf("Client disconnected (%s) after %v, dropped events: %d", reason, lifetime, c.dropped)
+}
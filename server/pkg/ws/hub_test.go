@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalesceDropsOldestForV1SlowConsumer(t *testing.T) {
+	h, err := NewHub(Coalesce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Connection{Send: make(chan *Event, 2), Protocol: ProtocolV1}
+	h.Connections[c] = true
+
+	for seq := uint64(1); seq <= 5; seq++ {
+		h.send(c, &Event{Type: CrashAdded, Seq: seq, Time: time.Now()})
+	}
+
+	if !h.Connections[c] {
+		t.Fatal("v1 slow consumer was disconnected")
+	}
+	if c.skipped != nil {
+		t.Errorf("v1 slow consumer got skipped summary: %+v", c.skipped)
+	}
+	if c.dropped != 3 {
+		t.Errorf("dropped %d events, want 3", c.dropped)
+	}
+
+	for _, want := range []uint64{4, 5} {
+		if e := <-c.Send; e.Seq != want {
+			t.Errorf("got event %d, want %d", e.Seq, want)
+		}
+	}
+}
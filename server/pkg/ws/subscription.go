@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mateuszdyminski/auto/ingress/model"
+)
+
+// Subscription is sent by the client to receive only the matching crashes.
+// Zero values match everything, so empty subscription restores the full feed.
+// Operator and aircraft type are case insensitive and accept '*' and '?'
+// wildcards.
+type Subscription struct {
+	BBox          *BoundingBox `json:"bbox,omitempty"`
+	Operator      string       `json:"operator,omitempty"`
+	AircraftType  string       `json:"aircraftType,omitempty"`
+	MinFatalities int          `json:"minFatalities,omitempty"`
+	From          time.Time    `json:"from,omitempty"`
+	To            time.Time    `json:"to,omitempty"`
+}
+
+// BoundingBox is the area of the map. West greater than east crosses the antimeridian.
+type BoundingBox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// Matches reports whether the crash should be sent to the subscriber.
+func (s *Subscription) Matches(f *model.FlightCrash) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.BBox != nil && (f.LocationGPS == nil || !s.BBox.contains(f.LocationGPS)) {
+		return false
+	}
+
+	if !matchPattern(s.Operator, f.Operator) || !matchPattern(s.AircraftType, f.AircraftType) {
+		return false
+	}
+
+	if f.Fatalities.Total < s.MinFatalities {
+		return false
+	}
+
+	if !s.From.IsZero() && f.Date.Before(s.From) {
+		return false
+	}
+
+	return s.To.IsZero() || !f.Date.After(s.To)
+}
+
+// valid checks whether the subscription makes sense.
+func (s *Subscription) valid() bool {
+	if b := s.BBox; b != nil {
+		if b.South > b.North || b.South < -90 || b.North > 90 || b.West < -180 || b.East > 180 {
+			return false
+		}
+	}
+
+	return s.MinFatalities >= 0 && (s.From.IsZero() || s.To.IsZero() || !s.From.After(s.To))
+}
+
+func (b *BoundingBox) contains(l *model.Location) bool {
+	if l.Latitude < b.South || l.Latitude > b.North {
+		return false
+	}
+
+	if b.West <= b.East {
+		return l.Longitude >= b.West && l.Longitude <= b.East
+	}
+
+	return l.Longitude >= b.West || l.Longitude <= b.East
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && ok
+}
@@ -2,10 +2,10 @@ package ws
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/mateuszdyminski/auto/ingress/model"
 	"github.com/rs/zerolog/log"
 )
 
@@ -26,6 +26,7 @@ const (
 var Upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{ProtocolV2, ProtocolV1},
 }
 
 // connection is an middleman between the websocket connection and the hub.
@@ -34,7 +35,88 @@ type Connection struct {
 	Ws *websocket.Conn
 
 	// Buffered channel of outbound messages.
-	Send chan *model.FlightCrash
+	Send chan *Event
+
+	// Missed messages sent before the ones from Send.
+	Replay []*Event
+
+	// Negotiated subprotocol, ProtocolV1 or ProtocolV2.
+	Protocol string
+
+	// Filters of the crashes requested by the client, nil means all crashes.
+	mu           sync.RWMutex
+	subscription *Subscription
+
+	// Owned by the hub, close reason is read after Send is closed.
+	connected time.Time
+	dropped   int
+	skipped   *Skipped
+	closeCode int
+	closeText string
+}
+
+// CloseReason returns the code and the reason of the disconnection by the
+// hub. Valid once Send is closed.
+func (c *Connection) CloseReason() (int, string) {
+	if c.closeCode == 0 {
+		return websocket.CloseGoingAway, "server closed connection"
+	}
+	return c.closeCode, c.closeText
+}
+
+// Subscribe replaces the subscription of the connection.
+func (c *Connection) Subscribe(s *Subscription) {
+	c.mu.Lock()
+	c.subscription = s
+	c.mu.Unlock()
+}
+
+// Matches reports whether the event should be sent to the connection. Crashes
+// have to match the subscription, ProtocolV1 gets only the added and updated ones.
+func (c *Connection) Matches(e *Event) bool {
+	f := e.Flight()
+	if f == nil {
+		return c.Protocol == ProtocolV2
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.subscription.Matches(f)
+}
+
+// ReadPump reads subscriptions sent by the client. Client can change the
+// subscription anytime, malformed ones are ignored. Connection is
+// unregistered from the hub when the client goes away.
+func (c *Connection) ReadPump(h *Hub) {
+	defer func() {
+		h.Unregister <- c
+		c.Ws.Close()
+	}()
+
+	c.Ws.SetReadLimit(maxMessageSize)
+	c.Ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.Ws.SetPongHandler(func(string) error {
+		c.Ws.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := c.Ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Warn().Msgf("WS connection closed unexpectedly. Err: %v", err)
+			}
+			return
+		}
+
+		s := new(Subscription)
+		if err := json.Unmarshal(data, s); err != nil || !s.valid() {
+			log.Warn().Msgf("Ignoring malformed subscription: %s", data)
+			continue
+		}
+
+		c.Subscribe(s)
+	}
 }
 
 // write writes a message with the given message type and payload.
@@ -43,6 +125,31 @@ func (c *Connection) Write(mt int, payload []byte) error {
 	return c.Ws.WriteMessage(mt, payload)
 }
 
+// writeJSON writes the event as JSON, wrapped in Envelope for ProtocolV2 and
+// as bare flight crash otherwise. Connection is closed when the event can't
+// be marshalled.
+func (c *Connection) writeJSON(e *Event) error {
+	var message interface{} = e.Flight()
+	if c.Protocol == ProtocolV2 {
+		env, err := e.Envelope()
+		if err != nil {
+			log.Error().Msgf("Can't marshal event for ws cients. Err: %v", err)
+			c.Write(websocket.CloseMessage, []byte{})
+			return err
+		}
+		message = env
+	}
+
+	json, err := json.Marshal(message)
+	if err != nil {
+		log.Error().Msgf("Can't marshal log for ws cients. Err: %v", err)
+		c.Write(websocket.CloseMessage, []byte{})
+		return err
+	}
+
+	return c.Write(websocket.TextMessage, json)
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 func (c *Connection) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -50,22 +157,27 @@ func (c *Connection) WritePump() {
 		ticker.Stop()
 		c.Ws.Close()
 	}()
+
+	for _, message := range c.Replay {
+		if !c.Matches(message) {
+			continue
+		}
+
+		if err := c.writeJSON(message); err != nil {
+			return
+		}
+	}
+	c.Replay = nil
+
 	for {
 		select {
 		case message, ok := <-c.Send:
 			if !ok {
-				c.Write(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			json, err := json.Marshal(message)
-			if err != nil {
-				log.Error().Msgf("Can't marshal log for ws cients. Err: %v", err)
-				c.Write(websocket.CloseMessage, []byte{})
+				c.Write(websocket.CloseMessage, websocket.FormatCloseMessage(c.CloseReason()))
 				return
 			}
 
-			if err := c.Write(websocket.TextMessage, json); err != nil {
+			if err := c.writeJSON(message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -0,0 +1,172 @@
+// Package wsclient is a Go client of the flight crashes WebSocket feed served
+// on /wsapi/ws.
+//
+// The client speaks auto.v2 subprotocol, in which every server message is
+// a ws.Envelope:
+//
+//	{"type": "crash-added", "id": "jv1c2k9x-42", "seq": 42, "ts": "2018-05-01T10:00:00Z", "payload": {...}}
+//
+// with the payload depending on the type:
+//
+//	crash-added, crash-updated  model.FlightCrash
+//	crash-deleted               ws.Deleted
+//	stats-tick                  ws.Stats
+//	server-notice               ws.Notice
+//	crashes-skipped             ws.Skipped, when the client didn't keep up
+//
+// Client sends ws.Subscription to receive only the matching crashes, the
+// events other than crashes are always delivered. ID of the last received
+// event passed as Options.LastEventID to Dial replays the events missed
+// while disconnected.
+//
+// Servers also accept auto.v1 subprotocol, or none, and then send bare
+// model.FlightCrash JSON of the added and updated crashes only.
+//
+// Example:
+//
+//	c, err := wsclient.Dial("ws://localhost:8080/wsapi/ws", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	for {
+//		e, err := c.Next()
+//		if err != nil {
+//			return err
+//		}
+//		if e.Type == ws.CrashAdded {
+//			f, err := e.Flight()
+//			...
+//		}
+//	}
+package wsclient
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mateuszdyminski/auto/server/pkg/ws"
+)
+
+// Options of the connection.
+type Options struct {
+	// Since replays the events published after the time.
+	Since time.Time
+
+	// LastEventID replays the events published after the event with the ID.
+	LastEventID string
+
+	// Subscription narrows down the crashes from the beginning of the connection.
+	Subscription *ws.Subscription
+}
+
+// Client receives the events from the feed. Next and Subscribe may be
+// called concurrently, but none of them concurrently with itself.
+type Client struct {
+	conn   *websocket.Conn
+	lastID string
+}
+
+// Dial connects to the feed at the URL.
+func Dial(rawurl string, opts *Options) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts != nil {
+		q := u.Query()
+		if !opts.Since.IsZero() {
+			q.Set("since", opts.Since.Format(time.RFC3339))
+		}
+		if opts.LastEventID != "" {
+			q.Set("lastEventId", opts.LastEventID)
+		}
+		// sent with the handshake, so even the first events are filtered
+		if opts.Subscription != nil {
+			subscriptionQuery(q, opts.Subscription)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{ws.ProtocolV2}
+
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.Subprotocol() != ws.ProtocolV2 {
+		conn.Close()
+		return nil, fmt.Errorf("server doesn't support %s protocol", ws.ProtocolV2)
+	}
+
+	return &Client{conn: conn}, nil
+}
+
+// subscriptionQuery sets the subscription as the handshake query parameters.
+func subscriptionQuery(q url.Values, s *ws.Subscription) {
+	if s.BBox != nil {
+		var coords []string
+		for _, c := range []float64{s.BBox.West, s.BBox.South, s.BBox.East, s.BBox.North} {
+			coords = append(coords, strconv.FormatFloat(c, 'f', -1, 64))
+		}
+		q.Set("bbox", strings.Join(coords, ","))
+	}
+	if s.Operator != "" {
+		q.Set("operator", s.Operator)
+	}
+	if s.AircraftType != "" {
+		q.Set("aircraftType", s.AircraftType)
+	}
+	if s.MinFatalities > 0 {
+		q.Set("minFatalities", strconv.Itoa(s.MinFatalities))
+	}
+	if !s.From.IsZero() {
+		q.Set("from", s.From.Format(time.RFC3339))
+	}
+	if !s.To.IsZero() {
+		q.Set("to", s.To.Format(time.RFC3339))
+	}
+}
+
+// Next blocks until the next event arrives.
+func (c *Client) Next() (*ws.Envelope, error) {
+	e := new(ws.Envelope)
+	if err := c.conn.ReadJSON(e); err != nil {
+		return nil, err
+	}
+
+	if e.ID != "" {
+		c.lastID = e.ID
+	}
+
+	return e, nil
+}
+
+// LastEventID returns the ID of the last numbered event, to be passed in
+// Options when reconnecting.
+func (c *Client) LastEventID() string {
+	return c.lastID
+}
+
+// Subscribe replaces the subscription. Nil subscription restores the full feed.
+func (c *Client) Subscribe(s *ws.Subscription) error {
+	if s == nil {
+		s = &ws.Subscription{}
+	}
+
+	return c.conn.WriteJSON(s)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.conn.Close()
+}